@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// Multiattack says which attack (index into Attacks) a creature makes and
+// how many times when it takes the Multiattack action.
+type Multiattack struct {
+	Attack int
+	Count  int
+}
+
+// ActionUsage tracks what a combatant has spent during the current turn.
+type ActionUsage struct {
+	Action   bool
+	Bonus    bool
+	Reaction bool
+}
+
+func init() {
+	onCombatEvent(StartOfTurn, resetActions)
+}
+
+// resetActions clears usage for the char with the turn and any other
+// instances of it, since NPC instances share an initiative entry.
+func resetActions(char Char) {
+	for i := range world.Npcs {
+		if world.Npcs[i].Name == char.Name {
+			clearUsage(world.Npcs[i].Key)
+		}
+	}
+	clearUsage(char.Key)
+}
+
+func clearUsage(key string) {
+	c := getCombatant(key)
+	c.Actions = ActionUsage{}
+	setCombatant(key, c)
+}
+
+func clearActions() {
+	updateCombatants(func(c *Combatant) { c.Actions = ActionUsage{} })
+}
+
+// useAction marks kind ("action", "bonus" or "reaction") as spent for char.
+// It returns false if it was already spent this turn. Outside of combat
+// nothing is tracked.
+func useAction(char Char, kind string) bool {
+	if !inCombat() {
+		return true
+	}
+
+	c := getCombatant(char.Key)
+	usage := c.Actions
+	used := false
+	if kind == "action" {
+		used = usage.Action
+		usage.Action = true
+	} else if kind == "bonus" {
+		used = usage.Bonus
+		usage.Bonus = true
+	} else if kind == "reaction" {
+		used = usage.Reaction
+		usage.Reaction = true
+	}
+
+	if used {
+		sendConsole(fmt.Sprintf("%s has already used its %s this turn.\n", char.Name, kind))
+		return false
+	}
+	c.Actions = usage
+	setCombatant(char.Key, c)
+	return true
+}
+
+func renderActionUsage(char Char) string {
+	usage := getCombatant(char.Key).Actions
+	output := ""
+	if usage.Action {
+		output = output + "A"
+	}
+	if usage.Bonus {
+		output = output + "B"
+	}
+	if usage.Reaction {
+		output = output + "R"
+	}
+	return output
+}
+
+// attackSequence returns the attack indexes char makes with its action,
+// expanding Multiattack if it has one.
+func attackSequence(char Char) []int {
+	seq := make([]int, 0)
+	for i := range char.Multiattack {
+		for n := 0; n < char.Multiattack[i].Count; n++ {
+			seq = append(seq, char.Multiattack[i].Attack)
+		}
+	}
+
+	if len(seq) == 0 {
+		seq = append(seq, 0)
+	}
+	return seq
+}
+
+func multiattack(char1 Char, char2 Char, adv string) string {
+	msg := ""
+	seq := attackSequence(char1)
+	for i := range seq {
+		if getHP(char2.Key) <= 0 {
+			sendConsole(fmt.Sprintln(char2.Name, "is down, multiattack ends."))
+			break
+		}
+		msg = msg + attack(char1, seq[i], char2, adv) + "<br>"
+	}
+	return msg
+}
+
+// autoActions runs char's turn for autoFight. Unless its strategy has it
+// flee, it spends its action on its multiattack or, failing that, its best
+// attack, picking a new target with the strategy whenever the current one
+// drops.
+func autoActions(char Char) string {
+	c := getCombatant(char.Key)
+	if c.Fled {
+		return ""
+	}
+
+	strat := getStrategy(char)
+	if strat.shouldFlee(char) {
+		c.Fled = true
+		setCombatant(char.Key, c)
+		return fmt.Sprintf("%s flees!", char.Name)
+	}
+
+	if !useAction(char, "action") {
+		return ""
+	}
+
+	msg := ""
+	target := Char{}
+	seq := attackSequence(char)
+	for i := range seq {
+		if target.Name == "" || getHP(target.Key) <= 0 {
+			targets := liveTargets(char)
+			if len(targets) == 0 {
+				sendConsole(fmt.Sprintln("No one left for", char.Name, "to attack."))
+				break
+			}
+			target = strat.chooseTarget(char, targets)
+		}
+
+		atti := seq[i]
+		if len(char.Multiattack) == 0 {
+			atti = bestAttack(char, target)
+		}
+		msg = msg + attack(char, atti, target, "") + "<br>"
+	}
+	return msg
+}
+
+// actCommand handles "act KEY multiattack|ATTINDEX TARGET [adv|dis]" and
+// "act KEY bonus|reaction ATTINDEX TARGET [adv|dis]".
+func actCommand(cmd Command) string {
+	if len(cmd.Args) < 3 {
+		sendConsole(fmt.Sprintln("Usage: act KEY multiattack|ATTINDEX|bonus ATTINDEX|reaction ATTINDEX TARGET [adv|dis]"))
+		return ""
+	}
+
+	char1 := getNpcOrChar(cmd.Args[0])
+	if char1.Name == "" {
+		sendConsole(fmt.Sprintln("Failed to load ", cmd.Args[0]))
+		return ""
+	}
+
+	kind := "action"
+	args := cmd.Args[1:]
+	if args[0] == "bonus" || args[0] == "reaction" {
+		kind = args[0]
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		sendConsole(fmt.Sprintln("Missing attack or target."))
+		return ""
+	}
+
+	char2 := getNpcOrChar(args[1])
+	if char2.Name == "" {
+		sendConsole(fmt.Sprintln("Failed to load ", args[1]))
+		return ""
+	}
+
+	adv := ""
+	if len(args) >= 3 {
+		adv = args[2]
+	}
+
+	if args[0] == "multiattack" {
+		if kind != "action" {
+			sendConsole(fmt.Sprintln("Multiattack takes an action."))
+			return ""
+		}
+		if len(char1.Multiattack) == 0 {
+			sendConsole(fmt.Sprintln(char1.Name, "has no multiattack."))
+			return ""
+		}
+		if !useAction(char1, kind) {
+			return ""
+		}
+		return multiattack(char1, char2, adv)
+	}
+
+	atti, err := strconv.Atoi(args[0])
+	if err != nil || atti >= len(char1.Attacks) {
+		sendConsole(fmt.Sprintln("Invalid attack index ", args[0]))
+		return ""
+	}
+	if !useAction(char1, kind) {
+		return ""
+	}
+	return attack(char1, atti, char2, adv)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestAttackSequence(t *testing.T) {
+	char := Char{Multiattack: []Multiattack{{Attack: 0, Count: 2}, {Attack: 1, Count: 1}}}
+	if seq := attackSequence(char); len(seq) != 3 || seq[0] != 0 || seq[1] != 0 || seq[2] != 1 {
+		t.Log("Expected two of attack 0 and one of attack 1 but got ", seq)
+		t.Fail()
+	}
+
+	if seq := attackSequence(Char{}); len(seq) != 1 || seq[0] != 0 {
+		t.Log("Expected a single first attack without multiattack but got ", seq)
+		t.Fail()
+	}
+}
+
+func TestMultiattackCommand(t *testing.T) {
+	simRand = rand.New(rand.NewSource(1))
+	simWorld(t, 100)
+	world.Chars[0].Attacks = append(world.Chars[0].Attacks, Attack{Name: "shield bash", Verb: "bashes", Hitbonus: 6, Damageroll: "1d4"})
+	world.Chars[0].Multiattack = []Multiattack{{Attack: 0, Count: 2}, {Attack: 1, Count: 1}}
+	setupSimFight([]string{"fig"}, []string{"gob"})
+	gob := world.Npcs[0].Key
+
+	world.Battlelog = ""
+	actCommand(Command{Name: "act", Args: []string{"fig", "multiattack", gob}})
+	if strings.Count(world.Battlelog, "with longsword") != 2 || strings.Count(world.Battlelog, "with shield bash") != 1 {
+		t.Log("Expected two longsword attacks and a shield bash but got ", world.Battlelog)
+		t.Fail()
+	}
+
+	if actCommand(Command{Name: "act", Args: []string{"fig", "0", gob}}) != "" {
+		t.Log("Expected the action to be spent on the multiattack")
+		t.Fail()
+	}
+	if actCommand(Command{Name: "act", Args: []string{"fig", "bonus", "1", gob}}) == "" {
+		t.Log("Expected the bonus action still to be free")
+		t.Fail()
+	}
+}
+
+func TestActionUsage(t *testing.T) {
+	simWorld(t, 7)
+	fig := world.Chars[0]
+
+	if !useAction(fig, "action") || !useAction(fig, "action") {
+		t.Log("Expected actions not to be tracked outside combat")
+		t.Fail()
+	}
+
+	setupSimFight([]string{"fig"}, []string{"gob"})
+	clearActions()
+	if !useAction(fig, "action") || useAction(fig, "action") || !useAction(fig, "reaction") {
+		t.Log("Expected one action and one reaction a turn but got ", renderActionUsage(fig))
+		t.Fail()
+	}
+
+	resetActions(fig)
+	if renderActionUsage(fig) != "" || !useAction(fig, "action") {
+		t.Log("Expected the action back at the start of the turn but got ", renderActionUsage(fig))
+		t.Fail()
+	}
+}
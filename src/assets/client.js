@@ -0,0 +1,394 @@
+// Table client for the JSON protocol on /ws?proto=json. The server sends
+// the whole view when the client connects and then numbered patches with
+// only what changed. The client redraws just those parts of #mainpage,
+// laid out the same way as the HTML page the server renders.
+
+var PROTOCOL_VERSION = 3;
+
+var view = {};
+// number of the last update taken into the view
+var seq = 0;
+// a patch was missed and the whole view has been asked for
+var resyncing = false;
+
+// what is on the page now, to leave alone what hasn't changed
+var shownImage = null;
+var shownMugs = null;
+var playingTrack = "";
+
+function esc(s) {
+	return String(s == null ? "" : s).replace(/&/g, "&amp;").replace(/</g, "&lt;").replace(/>/g, "&gt;").replace(/"/g, "&quot;").replace(/'/g, "&#39;");
+}
+
+function isDM() {
+	return getCookie('playername') == 'ohgodmedusa';
+}
+
+// showsTable is whether this page is the table. The character sheets, the
+// shop and the history are pages of their own that updates mustn't replace.
+function showsTable() {
+	var path = window.location.pathname;
+	return path == "/" || path == "/attack";
+}
+
+function renderPartyMember(p) {
+	var extra = "";
+	if (p.LevelUp) {
+		extra += '<br><span class="levelup">level up!</span>';
+	}
+	if (p.Encumbrance) {
+		extra += '<br><span class="encumbered">' + esc(p.Encumbrance) + '</span>';
+	}
+	var stats = esc(p.Race) + '/' + esc(p.Class) + '/' + p.Level + '<br>' + p.HP + '/' + p.MaxHP + extra;
+	if (!view.scene || !view.scene.Mugs) {
+		return '<div id="' + esc(p.Name) + '" data-key="' + esc(p.Key) + '" class="partymembernoimg"><b>' + esc(p.Name) + '</b><br>' + stats + '</div>';
+	}
+	return '<div id="' + esc(p.Name) + '" data-key="' + esc(p.Key) + '" class="partymember"><div><a href="/char?name=' + encodeURIComponent(p.Name) + '"><img src="' + esc(p.Image) + '" width=180/></a></div><b>' + esc(p.Name) + '</b><br>' + stats + '</div>';
+}
+
+function renderNpc(n) {
+	if (!view.scene || !view.scene.Mugs) {
+		return '<div data-key="' + esc(n.Key) + '" class="npcnoimg"><b>' + esc(n.Name) + '</b><br>' + esc(n.Race) + '</div>';
+	}
+	return '<div data-key="' + esc(n.Key) + '" class="npc"><a href="/char?name=' + encodeURIComponent(n.Name) + '"><img src="' + esc(n.Image) + '" width=180/></a><br><b><span style="color: ' + esc(n.Wounded) + '">' + esc(n.Name) + ' (' + esc(n.Key) + ')</span></b><br>' + esc(n.Race) + '</div>';
+}
+
+function findMember(key) {
+	var all = (view.party || []).concat(view.npcs || []);
+	for (var i = 0; i < all.length; i++) {
+		if (all[i].Key == key) {
+			return all[i];
+		}
+	}
+	return null;
+}
+
+// renderCombatant draws key from the party or the NPCs.
+function renderCombatant(key) {
+	var i;
+	for (i = 0; view.party && i < view.party.length; i++) {
+		if (view.party[i].Key == key) {
+			return renderPartyMember(view.party[i]);
+		}
+	}
+	for (i = 0; view.npcs && i < view.npcs.length; i++) {
+		if (view.npcs[i].Key == key) {
+			return renderNpc(view.npcs[i]);
+		}
+	}
+	return "";
+}
+
+// turnElapsed is the time since start, written like the server's console
+// writes it, such as "1m5s".
+function turnElapsed(start) {
+	var secs = Math.round((Date.now() - Date.parse(start)) / 1000);
+	if (!(secs > 0)) {
+		return "0s";
+	}
+	var output = (secs % 60) + "s";
+	if (secs >= 60) {
+		output = (Math.floor(secs / 60) % 60) + "m" + output;
+	}
+	if (secs >= 3600) {
+		output = Math.floor(secs / 3600) + "h" + output;
+	}
+	return output;
+}
+
+// tickTurnTime counts up the time the current turn has taken.
+function tickTurnTime() {
+	if (view.initiative && view.initiative.Round > 0) {
+		$("#turntime").text("(" + turnElapsed(view.initiative.Turnstart) + ")");
+	}
+}
+
+function renderInitiative(init) {
+	if (!init || !init.Entries || init.Entries.length == 0) {
+		return "";
+	}
+	var output = "";
+	if (init.Round > 0) {
+		output += '<span id="round">Round ' + init.Round + '</span> <span id="turntime">(' + turnElapsed(init.Turnstart) + ')</span><br>';
+	}
+	for (var i = 0; i < init.Entries.length; i++) {
+		var e = init.Entries[i];
+		var text = esc(e.Text);
+		if (e.Current) {
+			text = '<span id="currentturn">' + text + '</span>';
+		}
+		if (e.Legendary) {
+			text += ' <span class="legendary">' + esc(e.Legendary) + '</span>';
+		}
+		output += text + '<br>';
+	}
+	return '<div id="initiative"><span id="initiativetxt">' + output + '</span></div>';
+}
+
+// postButton is a one button form, as taking things changes the world.
+function postButton(cls, action, name, value, label) {
+	return '<form class="' + cls + '" action="' + action + '" method="post"><input type="hidden" name="' + name + '" value="' + esc(value) + '"/><input type="submit" value="' + label + '"/></form>';
+}
+
+function renderLoot(scene) {
+	var output = "";
+	if (scene.Coins || (scene.Loot && scene.Loot.length > 0)) {
+		output += '<div id="loot"><b>Loot</b><br>';
+		if (scene.Coins) {
+			output += esc(scene.Coins) + ' ' + postButton("claim", "/claim", "coins", "1", "Take") + '<br>';
+		}
+		for (var i = 0; scene.Loot && i < scene.Loot.length; i++) {
+			output += esc(scene.Loot[i].Name) + ' ' + postButton("claim", "/claim", "obj", scene.Loot[i].Key, "Take") + '<br>';
+		}
+		output += '</div>';
+	}
+	if (scene.Shop) {
+		output += '<div id="shoplink"><a class="claim" href="/shop">Shop</a></div>';
+	}
+	return output;
+}
+
+// renderPage lays out the empty page the parts are drawn into.
+function renderPage() {
+	$("#mainpage").text("");
+	$("#mainpage").append('<div id="mainarea"><div id="title"></div><div id="desc"></div><div id="msg"><div id="initiativebox"></div><div id="msgtxt"></div></div><div class="flex-container" id="npcs"><div id="npclist"></div><div id="lootbox"></div></div><div id="popupbox"></div></div><div class="flex-container" id="party"></div><div id="viewbox"></div>');
+	if (getCookie('playername') != '' && !isDM()) {
+		$("#mainpage").append('<div id="playertools"><br><a href="/playeredit">Edit Character</a> | <a href="/history">History</a> | <a href="/logout">Log Out</a> </div>');
+	}
+	shownImage = null;
+	shownMugs = null;
+}
+
+function renderScene() {
+	var scene = view.scene || {};
+	if (scene.Image != shownImage) {
+		shownImage = scene.Image;
+		$("#picture").text("");
+		if (scene.Image) {
+			$("#picture").append("<img height=1000 src='" + esc(scene.Image) + "'/>");
+		}
+	}
+	$("#picture").css("opacity", scene.NoText ? "1" : ".47");
+	$("#title").html(esc(scene.Name));
+	$("#desc").html(scene.Desc || "");
+	$("#lootbox").html(renderLoot(scene));
+}
+
+// renderList draws the members of a list that changed, or all of them if
+// the list itself changed.
+function renderList(box, members, draw, changed) {
+	var shown = [];
+	$(box).children().each(function() {
+		shown.push($(this).attr("data-key"));
+	});
+	var keys = [];
+	for (var i = 0; i < members.length; i++) {
+		keys.push(members[i].Key);
+	}
+
+	if (changed == null || shown.join(",") != keys.join(",")) {
+		var output = "";
+		for (i = 0; i < members.length; i++) {
+			output += draw(members[i]);
+		}
+		$(box).html(output);
+		return;
+	}
+	for (i = 0; i < members.length; i++) {
+		if (changed[members[i].Key]) {
+			$(box).children('[data-key="' + members[i].Key + '"]').replaceWith(draw(members[i]));
+		}
+	}
+}
+
+function renderPopup(animate) {
+	var msg = view.message || {};
+	var popup = "";
+	if (view.battle) {
+		var b = view.battle;
+		var attacker = findMember(b.Attacker) || {Name: b.Attacker};
+		var target = findMember(b.Target) || {Name: b.Target};
+		popup = '<div id="popup" class="fight-box"> <header>' + esc(attacker.Name) + ' vs ' + esc(target.Name) + '</header> <div class="modal-body">' + renderCombatant(b.Attacker) + ' <div id="battlemsg">' + b.Text + '</div>' + renderCombatant(b.Target) + '</div> <footer/> </div>';
+	} else if (msg.Kind == "modal") {
+		popup = '<div id="popup" class="fight-box"> <div class="modal-body"><span id="modalmsg">' + msg.Text + '</span></div> </div>';
+	}
+
+	if (popup == "") {
+		$(".fight-box, .modal-overlay").fadeOut(500, function() { $(this).remove(); });
+		return;
+	}
+	$("#popupbox").html(popup);
+	if ($(".modal-overlay").length == 0) {
+		$("#mainarea").append("<div class='modal-overlay js-modal-close'></div>");
+		$(".modal-overlay").css("opacity", ".90");
+	}
+	if (animate) {
+		$("#popup").fadeIn("slow");
+	} else {
+		$("#popup").show();
+	}
+}
+
+function renderMessage() {
+	var msg = view.message || {};
+	var scene = view.scene || {};
+	if (scene.NoText) {
+		$("#mainarea, #party, #viewbox").hide();
+	} else if (msg.Kind == "view") {
+		$("#mainarea, #party").hide();
+		$("#viewbox").html('<div id="msg">' + msg.Text + '</div>').show();
+	} else {
+		$("#viewbox").hide();
+		$("#mainarea, #party").show();
+	}
+	$("#msgtxt").html(msg.Kind == "modal" ? "" : (msg.Text || ""));
+}
+
+function playMusic() {
+	var track = view.music ? view.music.Track : "";
+	if (track == "Off") {
+		track = "";
+	}
+	if (track == playingTrack) {
+		return;
+	}
+	playingTrack = track;
+	$("#music").remove();
+	if (track) {
+		$("body").append('<audio id="music" autoplay loop src="/assets/' + esc(track) + '"></audio>');
+	}
+}
+
+// render redraws the parts in changed, which maps a message type to true,
+// or for party and npcs to the keys of the members that changed. With no
+// changed it draws everything.
+function render(changed) {
+	var all = changed == null;
+	changed = changed || {};
+	if ($("#mainarea").length == 0 || $("#popupbox").length == 0) {
+		renderPage();
+		all = true;
+	}
+
+	var mugs = view.scene ? view.scene.Mugs : false;
+	var relist = all || mugs != shownMugs;
+	shownMugs = mugs;
+
+	if (all || changed.scene) {
+		renderScene();
+	}
+	if (relist || changed.party) {
+		renderList("#party", view.party || [], renderPartyMember, relist ? null : changed.party);
+	}
+	if (relist || changed.npcs) {
+		renderList("#npclist", view.npcs || [], renderNpc, relist ? null : changed.npcs);
+	}
+	if (all || changed.initiative) {
+		$("#initiativebox").html(renderInitiative(view.initiative));
+	}
+	if (all || changed.scene || changed.message) {
+		renderMessage();
+	}
+	if (all || changed.battle || changed.message || changed.party || changed.npcs) {
+		renderPopup(all || changed.battle || changed.message);
+	}
+	if (all || changed.music) {
+		playMusic();
+	}
+
+	if (isDM()) {
+		$(".attacks").hide();
+		$(".claim").hide();
+	}
+}
+
+// patchList takes the members of a list patch into the view and returns
+// the keys of those that changed.
+function patchList(type, m) {
+	var changed = {};
+	var members = m.Data || [];
+	for (var i = 0; i < members.length; i++) {
+		changed[members[i].Key] = true;
+	}
+	if (!m.Keys) {
+		view[type] = members;
+		return changed;
+	}
+
+	var old = {};
+	var list = view[type] || [];
+	for (i = 0; i < list.length; i++) {
+		old[list[i].Key] = list[i];
+	}
+	for (i = 0; i < members.length; i++) {
+		old[members[i].Key] = members[i];
+	}
+	list = [];
+	for (i = 0; i < m.Keys.length; i++) {
+		list.push(old[m.Keys[i]]);
+	}
+	view[type] = list;
+	return changed;
+}
+
+// applyUpdate takes an update into the view and returns what changed, or
+// null if it couldn't be taken: it was old, or one went missing before it.
+function applyUpdate(update, conn) {
+	if (update.Full) {
+		view = {};
+		seq = update.Seq;
+		resyncing = false;
+	} else if (resyncing || update.Seq <= seq) {
+		return null;
+	} else if (update.Seq != seq + 1) {
+		resyncing = true;
+		conn.send(JSON.stringify({Type: "resync"}));
+		return null;
+	} else {
+		seq = update.Seq;
+	}
+
+	var changed = {};
+	for (var i = 0; i < update.Messages.length; i++) {
+		var m = update.Messages[i];
+		if (m.Type == "party" || m.Type == "npcs") {
+			changed[m.Type] = patchList(m.Type, m);
+		} else {
+			view[m.Type] = m.Data;
+			changed[m.Type] = true;
+		}
+	}
+	return changed;
+}
+
+// useHTML switches this browser to the page the server renders.
+function useHTML() {
+	document.cookie = "display=html";
+	window.location.reload();
+}
+
+var ticking = null;
+
+function startClient(host) {
+	if (ticking == null) {
+		ticking = setInterval(tickTurnTime, 1000);
+	}
+	var conn = new WebSocket("ws://" + host + "/ws?proto=json");
+	conn.onmessage = function(evt) {
+		var update = JSON.parse(evt.data);
+		if (update.Version != PROTOCOL_VERSION) {
+			conn.onclose = null;
+			conn.close();
+			useHTML();
+			return;
+		}
+		var changed = applyUpdate(update, conn);
+		if (changed != null && showsTable()) {
+			render(update.Full ? null : changed);
+		}
+	};
+	// the server sends the whole view again on reconnecting
+	conn.onclose = function(evt) {
+		setTimeout(function() { startClient(host); }, 2000);
+	};
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Default pause after each autof action, so the table can read it.
+const autoFightDelay = 2000 * time.Millisecond
+
+// Pause after autof moves on to the next turn.
+const autoFightTurnPause = 100 * time.Millisecond
+
+// autoFightJob is an autof running in the background. The processor
+// changes its settings while the job's goroutine waits between actions, so
+// they are kept behind a lock of their own.
+type autoFightJob struct {
+	mu       sync.Mutex
+	delay    time.Duration
+	paused   bool
+	stopped  bool
+	stepping bool
+	// actions the DM has stepped on to in step mode
+	steps int
+	// pokes the job out of a wait when any of the above changes
+	wake chan bool
+	// closed once the job has finished its last action
+	done chan bool
+}
+
+// The running autof, or nil. Only touched by processor jobs.
+var autoJob *autoFightJob
+
+func newAutoFightJob(delay time.Duration, stepping bool) *autoFightJob {
+	return &autoFightJob{delay: delay, stepping: stepping, wake: make(chan bool, 1), done: make(chan bool)}
+}
+
+// change applies fn to the job's settings and wakes it to notice.
+func (job *autoFightJob) change(fn func(job *autoFightJob)) {
+	job.mu.Lock()
+	fn(job)
+	job.mu.Unlock()
+
+	select {
+	case job.wake <- true:
+	default:
+	}
+}
+
+// wait holds the job after an action or a turn. It waits out the delay,
+// or in step mode for the DM to step, or while paused for it to resume. It
+// reports false once the job has been stopped.
+func (job *autoFightJob) wait(action bool) bool {
+	job.mu.Lock()
+	delay := job.delay
+	job.mu.Unlock()
+	if !action && delay > autoFightTurnPause {
+		delay = autoFightTurnPause
+	}
+	deadline := time.Now().Add(delay)
+
+	for {
+		job.mu.Lock()
+		stopped := job.stopped
+		held := job.paused || (action && job.stepping && job.steps == 0)
+		stepped := action && job.stepping && !job.paused && job.steps > 0
+		if stepped {
+			job.steps--
+		}
+		job.mu.Unlock()
+
+		if stopped {
+			return false
+		}
+		if stepped {
+			return true
+		}
+		if held {
+			<-job.wake
+			continue
+		}
+
+		left := time.Until(deadline)
+		if left <= 0 {
+			return true
+		}
+		select {
+		case <-job.wake:
+		case <-time.After(left):
+		}
+	}
+}
+
+func (job *autoFightJob) isStopped() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.stopped
+}
+
+func (job *autoFightJob) isStepping() bool {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	return job.stepping
+}
+
+func (job *autoFightJob) String() string {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+
+	state := "running"
+	if job.paused {
+		state = "paused"
+	} else if job.stepping {
+		state = "stepping, press enter for the next action"
+	}
+	return fmt.Sprintf("autof %s, %v between actions", state, job.delay)
+}
+
+// startAutoFight runs autof in the background until one side is down,
+// combat ends or it is stopped.
+func startAutoFight(delay time.Duration, stepping bool) {
+	job := newAutoFightJob(delay, stepping)
+	autoJob = job
+	go func() {
+		runAutoFight(doWork, job.wait, job.isStopped)
+		doWork(func() {
+			if autoJob == job {
+				autoJob = nil
+			}
+		})
+		close(job.done)
+	}()
+}
+
+// stopAutoFight stops the running autof, if there is one. It finishes the
+// action it is on first.
+func stopAutoFight() bool {
+	if autoJob == nil {
+		return false
+	}
+	autoJob.change(func(job *autoFightJob) { job.stopped = true })
+	autoJob = nil
+	return true
+}
+
+// stepAutoFight lets an autof in step mode take its next action.
+func stepAutoFight() bool {
+	if autoJob == nil || !autoJob.isStepping() {
+		return false
+	}
+	autoJob.change(func(job *autoFightJob) { job.steps++ })
+	return true
+}
+
+// autoFightCommand handles "autof [delay=MS] [step]" to start fighting
+// automatically, and "autof pause|resume|stop|step|run|delay MS" to control
+// it while it runs.
+func autoFightCommand(cmd Command) string {
+	action := ""
+	if len(cmd.Args) > 0 && !strings.Contains(cmd.Args[0], "=") {
+		action = cmd.Args[0]
+	}
+
+	if autoJob == nil {
+		if action != "" && action != "step" {
+			sendConsole(fmt.Sprintln("autof isn't running."))
+			return ""
+		}
+		if !inCombat() {
+			sendConsole(fmt.Sprintln("Start combat before autof."))
+			return ""
+		}
+
+		delay := autoFightDelay
+		for i := range cmd.Args {
+			if strings.HasPrefix(cmd.Args[i], "delay=") {
+				ms, err := strconv.Atoi(strings.TrimPrefix(cmd.Args[i], "delay="))
+				if err != nil || ms < 0 {
+					sendConsole(fmt.Sprintln("Invalid delay", cmd.Args[i]))
+					return ""
+				}
+				delay = time.Duration(ms) * time.Millisecond
+			}
+		}
+		startAutoFight(delay, action == "step")
+		sendConsole(fmt.Sprintln(autoJob))
+		return " "
+	}
+
+	switch action {
+	case "":
+		sendConsole(fmt.Sprintln("autof is already running:", autoJob))
+		return ""
+	case "stop":
+		stopAutoFight()
+		sendConsole(fmt.Sprintln("autof stopped."))
+		return ""
+	case "pause":
+		autoJob.change(func(job *autoFightJob) { job.paused = true })
+	case "resume":
+		autoJob.change(func(job *autoFightJob) { job.paused = false })
+	case "step":
+		autoJob.change(func(job *autoFightJob) { job.stepping = true })
+	case "run":
+		autoJob.change(func(job *autoFightJob) { job.stepping = false; job.steps = 0 })
+	case "delay":
+		ms := -1
+		if len(cmd.Args) > 1 {
+			ms, _ = strconv.Atoi(cmd.Args[1])
+		}
+		if ms < 0 {
+			sendConsole(fmt.Sprintln("Usage: autof delay MS"))
+			return ""
+		}
+		autoJob.change(func(job *autoFightJob) { job.delay = time.Duration(ms) * time.Millisecond })
+	default:
+		sendConsole(fmt.Sprintln("Usage: autof [delay=MS] [step] | autof pause|resume|stop|step|run|delay MS"))
+		return ""
+	}
+	sendConsole(fmt.Sprintln(autoJob))
+	return ""
+}
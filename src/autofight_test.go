@@ -0,0 +1,172 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// waitResult runs job.wait in the background and returns what it reports.
+func waitResult(job *autoFightJob, action bool) chan bool {
+	result := make(chan bool, 1)
+	go func() { result <- job.wait(action) }()
+	return result
+}
+
+func expectWait(t *testing.T, result chan bool, want bool, what string) {
+	select {
+	case got := <-result:
+		if got != want {
+			t.Log("Expected wait to report ", want, " when ", what)
+			t.Fail()
+		}
+	case <-time.After(time.Second):
+		t.Log("Expected wait to return when ", what)
+		t.Fail()
+	}
+}
+
+func expectHeld(t *testing.T, result chan bool, what string) {
+	select {
+	case <-result:
+		t.Log("Expected wait to hold when ", what)
+		t.Fail()
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestAutoFightPause(t *testing.T) {
+	job := newAutoFightJob(0, false)
+	job.change(func(job *autoFightJob) { job.paused = true })
+	result := waitResult(job, true)
+	expectHeld(t, result, "paused")
+
+	job.change(func(job *autoFightJob) { job.paused = false })
+	expectWait(t, result, true, "resumed")
+
+	result = waitResult(job, true)
+	expectWait(t, result, true, "running with no delay")
+}
+
+func TestAutoFightStep(t *testing.T) {
+	job := newAutoFightJob(time.Hour, true)
+	result := waitResult(job, true)
+	expectHeld(t, result, "stepping")
+
+	job.change(func(job *autoFightJob) { job.steps++ })
+	expectWait(t, result, true, "stepped")
+
+	// moving to the next turn isn't an action and doesn't wait for a step
+	job.change(func(job *autoFightJob) { job.delay = 0 })
+	expectWait(t, waitResult(job, false), true, "changing turns")
+}
+
+func TestAutoFightStop(t *testing.T) {
+	job := newAutoFightJob(time.Hour, false)
+	result := waitResult(job, true)
+	expectHeld(t, result, "waiting out the delay")
+
+	job.change(func(job *autoFightJob) { job.stopped = true })
+	expectWait(t, result, false, "stopped")
+}
+
+func TestAutoFightEndCombat(t *testing.T) {
+	simWorld(t, 100)
+	setupSimFight([]string{"fig"}, []string{"gob"})
+
+	// the DM ends combat while autof waits after the first action
+	done := make(chan bool)
+	go func() {
+		runAutoFight(func(step func()) { step() }, func(bool) bool {
+			world.Outputar = make([]string, 0)
+			world.Currentturn = 0
+			return true
+		}, func() bool { return false })
+		done <- true
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Log("Expected autof to stop when combat ended")
+		t.Fail()
+	}
+}
+
+func TestAutoFightCommand(t *testing.T) {
+	simWorld(t, 100)
+	autoJob = nil
+
+	autoFightCommand(Command{Name: "autof"})
+	if autoJob != nil {
+		t.Log("Expected autof not to start outside combat")
+		t.Fail()
+	}
+
+	doWork(func() {
+		setupSimFight([]string{"fig"}, []string{"gob"})
+		autoFightCommand(Command{Name: "autof", Args: []string{"step"}})
+	})
+	running := autoJob
+	if running == nil || !running.isStepping() {
+		t.Log("Expected autof to start in step mode")
+		t.FailNow()
+	}
+
+	doWork(func() {
+		autoFightCommand(Command{Name: "autof", Args: []string{"delay", "5"}})
+		autoFightCommand(Command{Name: "autof", Args: []string{"stop"}})
+	})
+	if autoJob != nil || running.delay != 5*time.Millisecond || !running.stopped {
+		t.Log("Expected autof to take the new delay and stop")
+		t.Fail()
+	}
+	<-running.done
+}
+
+func TestAutoFightStoppedMidTurn(t *testing.T) {
+	simWorld(t, 100)
+	setupSimFight([]string{"fig"}, []string{"gob", "gob"})
+
+	// the DM stops autof while the first action is on the table
+	pauses := 0
+	stopped := false
+	runAutoFight(func(step func()) { step() }, func(bool) bool {
+		pauses++
+		stopped = true
+		return true
+	}, func() bool { return stopped })
+
+	if pauses != 1 {
+		t.Log("Expected autof to do nothing more once stopped but it paused ", pauses, " times")
+		t.Fail()
+	}
+}
+
+func TestAutoFightKilledNpc(t *testing.T) {
+	simRand = rand.New(rand.NewSource(5))
+	simWorld(t, 7)
+	setupSimFight([]string{"fig"}, []string{"gob", "gob"})
+	killed := ""
+	attacked := false
+
+	// the DM kills the second goblin after the first one attacks
+	runAutoFight(func(step func()) { step() }, func(action bool) bool {
+		if killed != "" {
+			attacked = attacked || getCombatant(killed).Actions.Action
+		} else if action && !getCharWithTurn().InParty {
+			killed = world.Npcs[1].Key
+			setHP(killed, -10)
+		}
+		return true
+	}, func() bool { return false })
+
+	if killed == "" {
+		t.Log("Expected the goblins to get a turn")
+		t.FailNow()
+	}
+	if attacked {
+		t.Log("Expected the dead goblin not to attack")
+		t.Fail()
+	}
+}
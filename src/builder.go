@@ -0,0 +1,178 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Most creatures build will put in one encounter.
+const buildMaxNpcs = 20
+
+// charMatches reports whether char passes a build filter: race=RACE,
+// tag=TAG, place=PLACE or a bare word matching any of its name, race or
+// tags.
+func charMatches(char Char, filter string) bool {
+	kv := strings.SplitN(filter, "=", 2)
+	if len(kv) == 2 {
+		if kv[0] == "race" {
+			return strings.EqualFold(char.Race, kv[1])
+		} else if kv[0] == "tag" {
+			return hasTag(char, kv[1])
+		} else if kv[0] == "place" {
+			pl := getPlace(kv[1])
+			for i := range pl.Creatures {
+				if pl.Creatures[i] == char.Key || pl.Creatures[i] == char.Name {
+					return true
+				}
+			}
+			for i := range pl.Autodrop {
+				if pl.Autodrop[i] == char.Key || pl.Autodrop[i] == char.Name {
+					return true
+				}
+			}
+			return false
+		}
+	}
+
+	filter = strings.ToLower(filter)
+	return strings.Contains(strings.ToLower(char.Name), filter) || strings.EqualFold(char.Race, filter) || hasTag(char, filter)
+}
+
+func hasTag(char Char, tag string) bool {
+	for i := range char.Tags {
+		if strings.EqualFold(char.Tags[i], tag) {
+			return true
+		}
+	}
+	return false
+}
+
+// buildCandidates is every stat block in chars.json passing all filters.
+func buildCandidates(filters []string) []Char {
+	candidates := make([]Char, 0)
+	for i := range world.Chars {
+		char := world.Chars[i]
+		if char.InParty || char.Playername != "" || charIsNpc(char.Key) || char.HP <= 0 {
+			continue
+		}
+
+		matches := true
+		for k := range filters {
+			if !charMatches(char, filters[k]) {
+				matches = false
+			}
+		}
+		if matches {
+			candidates = append(candidates, char)
+		}
+	}
+	return candidates
+}
+
+// buildEncounter picks creatures at random from candidates while the
+// adjusted XP stays under the next difficulty up, and reports whether it
+// reached the budget for difficulty.
+func buildEncounter(difficulty int, candidates []Char, party []Char) ([]Char, bool) {
+	thresholds := partyThresholds(party)
+	budget := thresholds[difficulty]
+	limit := thresholds[len(thresholds)-1] * 3 / 2
+	if difficulty < len(thresholds)-1 {
+		limit = thresholds[difficulty+1]
+	}
+
+	group := make([]Char, 0)
+	for len(group) < buildMaxNpcs {
+		fits := make([]Char, 0)
+		for i := range candidates {
+			_, adjusted := adjustedXP(append(group[:len(group):len(group)], candidates[i]), len(party))
+			if adjusted < limit {
+				fits = append(fits, candidates[i])
+			}
+		}
+		if len(fits) == 0 {
+			break
+		}
+
+		ran := rollInt(fmt.Sprintf("1d%d", len(fits)))
+		if ran < 1 || ran > len(fits) {
+			ran = 1
+		}
+		group = append(group, fits[ran-1])
+
+		_, adjusted := adjustedXP(group, len(party))
+		if adjusted >= budget {
+			break
+		}
+	}
+
+	_, adjusted := adjustedXP(group, len(party))
+	return group, adjusted >= budget
+}
+
+// buildCommand handles "build DIFFICULTY [FILTER...] [dry]".
+func buildCommand(cmd Command) bool {
+	if len(cmd.Args) < 1 {
+		sendConsole(fmt.Sprintln("Usage: build easy|medium|hard|deadly [race=RACE] [tag=TAG] [place=PLACE] [WORD] [dry]"))
+		return false
+	}
+
+	difficulty := -1
+	for i := range difficulties {
+		if difficulties[i] == cmd.Args[0] {
+			difficulty = i
+		}
+	}
+	if difficulty == -1 {
+		sendConsole(fmt.Sprintln("Unknown difficulty", cmd.Args[0]))
+		return false
+	}
+
+	dry := false
+	filters := make([]string, 0)
+	for i := 1; i < len(cmd.Args); i++ {
+		if cmd.Args[i] == "dry" {
+			dry = true
+		} else if cmd.Args[i] != "" {
+			filters = append(filters, cmd.Args[i])
+		}
+	}
+
+	party := partyChars()
+	if len(party) == 0 {
+		sendConsole(fmt.Sprintln("No one in the party to build for."))
+		return false
+	}
+
+	candidates := buildCandidates(filters)
+	if len(candidates) == 0 {
+		sendConsole(fmt.Sprintln("No creatures match", strings.Join(filters, " ")))
+		return false
+	}
+
+	group, ok := buildEncounter(difficulty, candidates, party)
+	if len(group) == 0 {
+		sendConsole(fmt.Sprintln("Every matching creature is too tough for a", cmd.Args[0], "encounter."))
+		return false
+	}
+
+	total, adjusted := adjustedXP(group, len(party))
+	names := make([]string, 0)
+	for i := range group {
+		names = append(names, fmt.Sprintf("%s (%s)", group[i].Name, group[i].Key))
+	}
+	output := fmt.Sprintf("%s: %d XP, adjusted %d XP, %s\n", strings.Join(names, ", "), total, adjusted, rateEncounter(adjusted, partyThresholds(party)))
+	if !ok {
+		output = output + fmt.Sprintf("Could not reach a %s encounter with these creatures.\n", cmd.Args[0])
+	}
+
+	if dry {
+		sendConsole("Would drop " + output)
+		return false
+	}
+
+	sendConsole("Dropping " + output)
+	for i := range group {
+		dropNpc(group[i].Key)
+	}
+	return true
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func buildWorld(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+	world.Chars = []Char{
+		{Name: "Ann", Key: "ann", InParty: true, Level: 3, HP: 24},
+		{Name: "Ben", Key: "ben", InParty: true, Level: 3, HP: 24},
+		{Name: "Goblin", Key: "gob", Race: "goblin", CR: "1/4", HP: 7, Tags: []string{"raider"}},
+		{Name: "Orc", Key: "orc", Race: "orc", CR: "1/2", HP: 15, Tags: []string{"raider"}},
+		{Name: "Wolf", Key: "wolf", Race: "beast", CR: "1/4", HP: 11, Tags: []string{"animal"}},
+	}
+	world.Npcs = make([]Char, 0)
+}
+
+func candidateKeys(filters ...string) string {
+	keys := ""
+	for _, char := range buildCandidates(filters) {
+		keys = keys + char.Key + " "
+	}
+	return keys
+}
+
+func TestBuildFilters(t *testing.T) {
+	buildWorld(t)
+
+	tests := []struct {
+		filters []string
+		want    string
+	}{
+		{[]string{"race=orc"}, "orc "},
+		{[]string{"tag=raider"}, "gob orc "},
+		{[]string{"tag=raider", "race=goblin"}, "gob "},
+		{[]string{"tag=animal", "race=goblin"}, ""},
+	}
+	for _, tt := range tests {
+		if got := candidateKeys(tt.filters...); got != tt.want {
+			t.Log("Expected ", tt.want, " for ", tt.filters, " but got ", got)
+			t.Fail()
+		}
+	}
+}
+
+func TestBuildBudget(t *testing.T) {
+	buildWorld(t)
+	simRand = rand.New(rand.NewSource(11))
+
+	party := partyChars()
+	thresholds := partyThresholds(party)
+	for i := 0; i < 20; i++ {
+		group, ok := buildEncounter(1, buildCandidates([]string{"tag=raider"}), party)
+		_, adjusted := adjustedXP(group, len(party))
+		if !ok || adjusted < thresholds[1] || adjusted >= thresholds[2] {
+			t.Log("Expected a medium encounter between ", thresholds[1], " and ", thresholds[2], " XP but got ", adjusted)
+			t.Fail()
+		}
+		for _, char := range group {
+			if char.Key == "wolf" {
+				t.Log("Expected only raiders but got a wolf")
+				t.Fail()
+			}
+		}
+	}
+}
+
+func TestBuildDry(t *testing.T) {
+	buildWorld(t)
+	simRand = rand.New(rand.NewSource(11))
+
+	if buildCommand(Command{Name: "build", Args: []string{"hard", "race=goblin", "dry"}}) || len(world.Npcs) != 0 {
+		t.Log("Expected a dry build to drop nothing but got ", len(world.Npcs), " NPCs")
+		t.Fail()
+	}
+	if buildCommand(Command{Name: "build", Args: []string{"hard", "race=dragon", "dry"}}) {
+		t.Log("Expected nothing to build from no matching creatures")
+		t.Fail()
+	}
+}
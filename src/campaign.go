@@ -0,0 +1,194 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Directory holding the campaigns other than the default one, each in a
+// directory of its own with assets and saves inside.
+const campaignsDir = "campaigns"
+
+// Name for the campaign kept in the working directory.
+const defaultCampaign = "default"
+
+// Data files copied from the default campaign into a new one.
+var campaignFiles = []string{"chars.json", "places.json", "objects.json", "loot.json"}
+
+// campaignRoot is the directory the active campaign's files are under.
+func campaignRoot() string {
+	if world.Campaign == "" {
+		return "."
+	}
+	return filepath.Join(campaignsDir, world.Campaign)
+}
+
+func campaignName() string {
+	if world.Campaign == "" {
+		return defaultCampaign
+	}
+	return world.Campaign
+}
+
+// assetPath is where the active campaign keeps an asset. A campaign can
+// leave out files, such as the class and race rules, to use the default
+// campaign's.
+func assetPath(name string) string {
+	path := filepath.Join(campaignRoot(), "assets", name)
+	if _, err := os.Stat(path); err != nil && world.Campaign != "" {
+		return filepath.Join("assets", name)
+	}
+	return path
+}
+
+// playerFile is a player's character file. Players belong to one campaign
+// so there is no falling back to the default one.
+func playerFile(playername string) string {
+	return filepath.Join(campaignRoot(), "assets", "players", playername+".json")
+}
+
+// playerList splits a comma separated list of players, skipping blanks.
+func playerList(charlist string) []string {
+	players := make([]string, 0)
+	for _, player := range strings.Split(charlist, ",") {
+		if player = strings.TrimSpace(player); player != "" {
+			players = append(players, player)
+		}
+	}
+	return players
+}
+
+// inCampaign is whether player plays in the active campaign.
+func inCampaign(player string) bool {
+	return player == dmPlayername || hasItem(world.Players, strings.ToLower(player))
+}
+
+func campaignExists(name string) bool {
+	if name == defaultCampaign {
+		return true
+	}
+	if !validSaveName.MatchString(name) {
+		return false
+	}
+	info, err := os.Stat(filepath.Join(campaignsDir, name))
+	return err == nil && info.IsDir()
+}
+
+func listCampaigns() []string {
+	names := []string{defaultCampaign}
+	files, err := ioutil.ReadDir(campaignsDir)
+	if err != nil {
+		return names
+	}
+	for i := range files {
+		if files[i].IsDir() {
+			names = append(names, files[i].Name())
+		}
+	}
+	return names
+}
+
+// newCampaign makes campaigns/NAME with a copy of the default campaign's
+// characters, places, objects and loot, and no players.
+func newCampaign(name string) error {
+	if !validSaveName.MatchString(name) || name == defaultCampaign {
+		return fmt.Errorf("campaign names are letters, numbers, - and _ only")
+	}
+	if campaignExists(name) {
+		return fmt.Errorf("there is already a campaign %s", name)
+	}
+
+	dir := filepath.Join(campaignsDir, name, "assets")
+	err := os.MkdirAll(filepath.Join(dir, "players"), 0755)
+	if err != nil {
+		return err
+	}
+	for i := range campaignFiles {
+		data, err := ioutil.ReadFile(filepath.Join("assets", campaignFiles[i]))
+		if err != nil {
+			return err
+		}
+		err = ioutil.WriteFile(filepath.Join(dir, campaignFiles[i]), data, 0644)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// openCampaign loads the active campaign: its assets, then its world as it
+// was left, from the history or else the autosave. Players given with
+// -chars are only used for a campaign that has no world saved yet.
+func openCampaign(fresh bool) {
+	historyOn = false
+	initialState(&world)
+	if !fresh && !rebuildFromHistory() {
+		resumeAutosave()
+	}
+	startHistory()
+}
+
+// switchCampaign saves the world and opens the campaign called name in its
+// place. Undo doesn't reach back into the old campaign.
+func switchCampaign(name string) error {
+	if !campaignExists(name) {
+		return fmt.Errorf("no campaign %s, make it with 'campaign new %s'", name, name)
+	}
+
+	logEvent(worldEvent, "campaign switch "+name, nil, fmt.Sprintf("The party leaves for the %s campaign.", name))
+	err := saveWorld(autosaveName)
+	if err != nil {
+		fmt.Println("Failed to save ", campaignName(), ": ", err)
+	}
+
+	stopAutoFight()
+	world.Campaign = name
+	if name == defaultCampaign {
+		world.Campaign = ""
+	}
+	world.Charlist = ""
+	world.Loggedin = make([]string, 0)
+	undoHistory = nil
+	redoHistory = nil
+	autosaveCount = 0
+	openCampaign(false)
+	return nil
+}
+
+// campaignCommand handles "campaign", "campaign switch NAME" and
+// "campaign new NAME".
+func campaignCommand(cmd Command) string {
+	if len(cmd.Args) == 0 {
+		sendConsole(fmt.Sprintf("Campaign: %s\nCampaigns: %s\n", campaignName(), strings.Join(listCampaigns(), ", ")))
+		return ""
+	}
+	if len(cmd.Args) < 2 {
+		sendConsole(fmt.Sprintln("Usage: campaign [switch|new NAME]"))
+		return ""
+	}
+
+	var err error
+	if cmd.Args[0] == "new" {
+		err = newCampaign(cmd.Args[1])
+		if err == nil {
+			sendConsole(fmt.Sprintln("Made campaign", cmd.Args[1]))
+		}
+	} else if cmd.Args[0] == "switch" {
+		err = switchCampaign(cmd.Args[1])
+	} else {
+		err = fmt.Errorf("no campaign command %s", cmd.Args[0])
+	}
+	if err != nil {
+		sendConsole(fmt.Sprintln(err))
+		return ""
+	}
+
+	if cmd.Args[0] == "switch" {
+		sendConsole(fmt.Sprintln("Now running", campaignName(), "with players", strings.Join(world.Players, ", ")))
+		return " "
+	}
+	return ""
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func campaignWorld(t *testing.T) {
+	testWorld(t)
+	os.Chdir(t.TempDir())
+	os.MkdirAll("assets/players", 0755)
+	for _, name := range campaignFiles {
+		ioutil.WriteFile(filepath.Join("assets", name), []byte("[]"), 0644)
+	}
+	ioutil.WriteFile("assets/players/bob.json", []byte(`{"Name": "Bob", "HP": 10}`), 0644)
+	world.Charlist = "bob"
+}
+
+func TestCampaignPaths(t *testing.T) {
+	campaignWorld(t)
+
+	if assetPath("chars.json") != "assets/chars.json" || saveDir() != "saves" {
+		t.Log("Expected the default campaign in the working directory but got ", assetPath("chars.json"), saveDir())
+		t.Fail()
+	}
+
+	newCampaign("north")
+	world.Campaign = "north"
+	if assetPath("chars.json") != "campaigns/north/assets/chars.json" || saveDir() != "campaigns/north/saves" {
+		t.Log("Expected the north campaign's own files but got ", assetPath("chars.json"), saveDir())
+		t.Fail()
+	}
+	if assetPath("classes") != "assets/classes" || playerFile("bob") != "campaigns/north/assets/players/bob.json" {
+		t.Log("Expected shared rules and campaign players but got ", assetPath("classes"), playerFile("bob"))
+		t.Fail()
+	}
+
+	if err := newCampaign("north"); err == nil {
+		t.Log("Expected a second north campaign to be refused")
+		t.Fail()
+	}
+	if names := listCampaigns(); len(names) != 2 || names[1] != "north" {
+		t.Log("Expected the default and north campaigns but got ", names)
+		t.Fail()
+	}
+}
+
+func TestSwitchCampaign(t *testing.T) {
+	campaignWorld(t)
+
+	openCampaign(false)
+	world.Place = "keep"
+	if len(world.Players) != 1 || !inCampaign("Bob") {
+		t.Log("Expected bob in the default campaign but got ", world.Players)
+		t.Fail()
+	}
+
+	newCampaign("north")
+	if err := switchCampaign("north"); err != nil || world.Campaign != "north" {
+		t.Log("Expected to switch to north but got ", err)
+		t.Fail()
+	}
+	if len(world.Players) != 0 || inCampaign("bob") || world.Place != "void" {
+		t.Log("Expected an empty north campaign but got ", world.Players, world.Place)
+		t.Fail()
+	}
+
+	world.Place = "pass"
+	switchCampaign(defaultCampaign)
+	if world.Campaign != "" || world.Place != "keep" || !inCampaign("bob") {
+		t.Log("Expected the default campaign back as it was left but got ", world.Place, world.Players)
+		t.Fail()
+	}
+
+	switchCampaign("north")
+	if world.Place != "pass" {
+		t.Log("Expected north as it was left but got ", world.Place)
+		t.Fail()
+	}
+
+	if err := switchCampaign("south"); err == nil {
+		t.Log("Expected switching to a missing campaign to fail")
+		t.Fail()
+	}
+}
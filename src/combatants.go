@@ -0,0 +1,93 @@
+package main
+
+// Combatant is the runtime state of a character in play: a player's hit
+// points and what anyone has spent this turn. It is kept by Key rather than
+// by place in world.Chars, which grows as NPCs are dropped and is rebuilt on
+// reload. NPC instances keep their hit points in CurHP.
+type Combatant struct {
+	HP        int
+	Actions   ActionUsage
+	Legendary int
+	Fled      bool
+}
+
+func getCombatant(key string) Combatant {
+	return world.Combatants[key]
+}
+
+// setCombatant stores c for key, dropping entries with nothing left in them
+// so reading a combatant and writing it back doesn't grow the map. Characters
+// that keep their hit points here are never dropped, or one down at 0 would
+// be back at full hit points after a reload.
+func setCombatant(key string, c Combatant) {
+	if world.Combatants == nil {
+		world.Combatants = make(map[string]Combatant)
+	}
+	if c == (Combatant{}) && !keepsHP(key) {
+		delete(world.Combatants, key)
+		return
+	}
+	world.Combatants[key] = c
+}
+
+// keepsHP is whether key is a character with its hit points in Combatants
+// rather than an NPC instance's CurHP.
+func keepsHP(key string) bool {
+	for i := range world.Chars {
+		if world.Chars[i].Key == key {
+			return !charIsNpc(key)
+		}
+	}
+	return false
+}
+
+// clearCombatants forgets everyone's runtime state, hit points included.
+func clearCombatants() {
+	world.Combatants = make(map[string]Combatant)
+}
+
+// updateCombatants applies fn to every tracked combatant.
+func updateCombatants(fn func(c *Combatant)) {
+	for key, c := range world.Combatants {
+		fn(&c)
+		setCombatant(key, c)
+	}
+}
+
+func getCharHP(key string) int {
+	return getCombatant(key).HP
+}
+
+func setCharHP(key string, hp int) {
+	c := getCombatant(key)
+	c.HP = hp
+	setCombatant(key, c)
+}
+
+// carryKeys gives chars rebuilt from disk the keys they had before, so the
+// state kept under them stays with the right character. Players are matched
+// by player name and everyone else by name. The rest get new keys.
+func carryKeys(chars []Char, old []Char) {
+	keys := make(map[string]string)
+	for i := range old {
+		// NPC instances come after the char they were dropped from
+		if _, ok := keys[old[i].Playername+"/"+old[i].Name]; !ok {
+			keys[old[i].Playername+"/"+old[i].Name] = old[i].Key
+		}
+	}
+
+	world.Chars = chars
+	for i := range chars {
+		chars[i].Key = ""
+	}
+	for i := range chars {
+		if key, ok := keys[chars[i].Playername+"/"+chars[i].Name]; ok && !prefixExists(key) {
+			chars[i].Key = key
+		}
+	}
+	for i := range chars {
+		if chars[i].Key == "" {
+			chars[i].Key = makeCharKey(chars[i].Name)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCarryKeys(t *testing.T) {
+	testWorld(t)
+	world = WorldState{}
+	clearCombatants()
+	world.Npcs = []Char{{Name: "Goblin", Key: "gob1", CurHP: 3}}
+	old := []Char{{Name: "Goblin", Key: "gob"}, {Name: "Bob", Key: "bob", Playername: "bob"}, world.Npcs[0]}
+	setCharHP("bob", 5)
+
+	// a new char in chars.json that would take Bob's key if keys were
+	// handed out in order again
+	chars := []Char{{Name: "Bobcat"}, {Name: "Goblin"}, {Name: "Bob", Playername: "bob"}}
+	carryKeys(chars, old)
+
+	want := []string{"bob1", "gob", "bob"}
+	for i := range want {
+		if world.Chars[i].Key != want[i] {
+			t.Log("Expected ", world.Chars[i].Name, " to have key ", want[i], " but got ", world.Chars[i].Key)
+			t.Fail()
+		}
+	}
+	if getHP("bob") != 5 || getHP("bob1") != 0 {
+		t.Log("Expected Bob to keep his hp but got ", world.Combatants)
+		t.Fail()
+	}
+}
+
+func TestCombatantState(t *testing.T) {
+	testWorld(t)
+	world = WorldState{}
+	clearCombatants()
+	setCharHP("fig", 20)
+	setLegendary("dra1", 3)
+
+	c := getCombatant("fig")
+	c.Actions.Action = true
+	setCombatant("fig", c)
+	clearActions()
+	clearLegendary()
+
+	if getCharHP("fig") != 20 || getCombatant("fig").Actions.Action {
+		t.Log("Expected the fighter's action to be cleared and his hp kept but got ", getCombatant("fig"))
+		t.Fail()
+	}
+	if _, ok := world.Combatants["dra1"]; ok {
+		t.Log("Expected nothing left for a dragon with no points")
+		t.Fail()
+	}
+}
+
+func TestReloadDownedPlayer(t *testing.T) {
+	campaignWorld(t)
+	initialState(&world)
+	bob := playerKey("bob")
+	setCharHP(bob, 0)
+
+	initChars(false)
+	if _, ok := world.Combatants[bob]; !ok || getCharHP(bob) != 0 {
+		t.Log("Expected bob to stay down after a reload but got ", getCharHP(bob))
+		t.Fail()
+	}
+
+	initChars(true)
+	if getCharHP(bob) != 10 {
+		t.Log("Expected wiping hit points to bring bob back up but got ", getCharHP(bob))
+		t.Fail()
+	}
+}
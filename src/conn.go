@@ -1,6 +1,8 @@
 package main
 
 import (
+	"encoding/json"
+	"fmt"
 	"github.com/gorilla/websocket"
 	"net/http"
 	"net"
@@ -14,6 +16,9 @@ type connection struct {
 
 	// Buffered channel of outbound messages.
 	send chan []byte
+
+	// Speaks the JSON protocol rather than being sent the HTML page.
+	json bool
 }
 
 type telnetconn struct {
@@ -27,6 +32,10 @@ func (c *connection) reader() {
 		if err != nil {
 			break
 		}
+		if c.json {
+			c.request(message)
+			continue
+		}
 		h.broadcast <- message
 	}
 	c.ws.Close()
@@ -50,6 +59,27 @@ func (c *telnetconn) writer() {
 	//*c.conn.Close()
 }
 
+// registerJSON registers a JSON client and sends it the whole view. It
+// runs on the processor so no update slips in between the two.
+func registerJSON(c *connection) {
+	doWork(func() {
+		h.register <- c
+		h.direct <- directMessage{c: c, data: fullUpdate()}
+	})
+}
+
+// request handles a message from a JSON client.
+func (c *connection) request(message []byte) {
+	req := clientRequest{}
+	if err := json.Unmarshal(message, &req); err != nil {
+		fmt.Println("Bad request from client: ", err)
+		return
+	}
+	if req.Type == resyncRequest {
+		doWork(func() { h.direct <- directMessage{c: c, data: fullUpdate()} })
+	}
+}
+
 var upgrader = &websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
 
 func wsHandler(w http.ResponseWriter, r *http.Request) {
@@ -57,8 +87,12 @@ func wsHandler(w http.ResponseWriter, r *http.Request) {
 	if err != nil {
 		return
 	}
-	c := &connection{send: make(chan []byte, 256), ws: ws}
-	h.register <- c
+	c := &connection{send: make(chan []byte, 256), ws: ws, json: r.FormValue("proto") == "json"}
+	if c.json {
+		registerJSON(c)
+	} else {
+		h.register <- c
+	}
 	defer func() { h.unregister <- c }()
 	go c.writer()
 	c.reader()
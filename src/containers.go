@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+)
+
+// Deepest nesting of containers followed, so an object that contains itself
+// can't loop forever.
+const maxContainerDepth = 10
+
+const (
+	unencumbered = iota
+	encumbered
+	heavilyEncumbered
+	overloaded
+)
+
+// objectWeight is the weight of an object and everything inside it.
+func objectWeight(key string) int {
+	return containerWeight(key, 0)
+}
+
+func containerWeight(key string, depth int) int {
+	obj := getObject(key)
+	weight := obj.Weight
+	if depth >= maxContainerDepth {
+		return weight
+	}
+	for i := range obj.Contains {
+		weight = weight + containerWeight(obj.Contains[i], depth+1)
+	}
+	return weight
+}
+
+func carriedWeight(char Char) int {
+	weight := 0
+	for i := range char.Inventory {
+		weight = weight + objectWeight(char.Inventory[i])
+	}
+	return weight
+}
+
+func carryingCapacity(char Char) int {
+	return char.Abilities.Str * 15
+}
+
+// encumbrance uses the variant rule: over 5 x Str is encumbered, over 10 x
+// Str heavily encumbered and over the carrying capacity the char can't move.
+func encumbrance(char Char) int {
+	weight := carriedWeight(char)
+	if weight > carryingCapacity(char) {
+		return overloaded
+	} else if weight > char.Abilities.Str*10 {
+		return heavilyEncumbered
+	} else if weight > char.Abilities.Str*5 {
+		return encumbered
+	}
+	return unencumbered
+}
+
+// effectiveSpeed is a char's speed after encumbrance.
+func effectiveSpeed(char Char) int {
+	speed := char.Speed
+	switch encumbrance(char) {
+	case encumbered:
+		speed = speed - 10
+	case heavilyEncumbered:
+		speed = speed - 20
+	case overloaded:
+		speed = 5
+	}
+	if speed < 0 {
+		speed = 0
+	}
+	return speed
+}
+
+func encumbranceName(level int) string {
+	return []string{"", "encumbered", "heavily encumbered", "overloaded"}[level]
+}
+
+func renderEncumbrance(char Char) string {
+	txt := encumbranceTxt(char)
+	if txt == "" {
+		return ""
+	}
+	return fmt.Sprintf("<br><span class=\"encumbered\">%s</span>", txt)
+}
+
+// encumbranceTxt is how loaded down char is, or "" if they aren't.
+func encumbranceTxt(char Char) string {
+	level := encumbrance(char)
+	if level == unencumbered || char.Abilities.Str == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%s, speed %d", encumbranceName(level), effectiveSpeed(char))
+}
+
+// renderContents lists what is inside an object and inside those in turn.
+func renderContents(obj Object, depth int) string {
+	if len(obj.Contains) == 0 || depth >= maxContainerDepth {
+		return ""
+	}
+
+	output := "<ul>"
+	for i := range obj.Contains {
+		inner := getObject(obj.Contains[i])
+		output = output + fmt.Sprintf("<li>%s (%s) %d lb", inner.Name, inner.Key, objectWeight(inner.Key))
+		output = output + renderContents(inner, depth+1) + "</li>"
+	}
+	return output + "</ul>"
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestContainerWeight(t *testing.T) {
+	testWorld(t)
+	world.Objects = []Object{
+		{Key: "pack", Weight: 5, Contains: []string{"pouch", "rope"}},
+		{Key: "pouch", Weight: 1, Contains: []string{"gems"}},
+		{Key: "gems", Weight: 2},
+		{Key: "rope", Weight: 10},
+		{Key: "bag", Weight: 1, Contains: []string{"bag"}},
+	}
+
+	if w := objectWeight("pack"); w != 18 {
+		t.Log("Expected the pack and everything in it to weigh 18 but got ", w)
+		t.Fail()
+	}
+
+	// a bag of holding inside itself stops at the depth limit
+	if w := objectWeight("bag"); w != maxContainerDepth+1 {
+		t.Log("Expected the self containing bag to stop at the depth limit but got ", w)
+		t.Fail()
+	}
+}
+
+func TestEncumbrance(t *testing.T) {
+	testWorld(t)
+	world.Objects = []Object{{Key: "anvil", Weight: 60}, {Key: "rope", Weight: 10}}
+
+	char := Char{Speed: 30, Abilities: Abilities{Str: 10}, Inventory: []string{"rope"}}
+	tests := []struct {
+		inventory []string
+		level     int
+		speed     int
+	}{
+		{[]string{"rope"}, unencumbered, 30},
+		{[]string{"anvil"}, encumbered, 20},
+		{[]string{"anvil", "anvil"}, heavilyEncumbered, 10},
+		{[]string{"anvil", "anvil", "anvil"}, overloaded, 5},
+	}
+
+	for _, tt := range tests {
+		char.Inventory = tt.inventory
+		if encumbrance(char) != tt.level || effectiveSpeed(char) != tt.speed {
+			t.Log("Expected ", encumbranceName(tt.level), " at speed ", tt.speed, " carrying ", tt.inventory, " but got ", encumbranceName(encumbrance(char)), effectiveSpeed(char))
+			t.Fail()
+		}
+	}
+}
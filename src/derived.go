@@ -0,0 +1,96 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Keys for Char.Overrides, each replacing the computed value of the stat it
+// names.
+const (
+	overrideInitiative     = "Initiative"
+	overrideProfBonus      = "ProfBonus"
+	overridePassPerception = "PassPerception"
+)
+
+func abilityScore(abil Abilities, name string) int {
+	switch strings.ToLower(name) {
+	case "str":
+		return abil.Str
+	case "dex":
+		return abil.Dex
+	case "con":
+		return abil.Con
+	case "int":
+		return abil.Int
+	case "wis":
+		return abil.Wis
+	case "cha":
+		return abil.Cha
+	}
+	return 10
+}
+
+// hasSkill reports whether skill is in the char's comma separated Skills.
+func hasSkill(char Char, skill string) bool {
+	skills := strings.Split(char.Skills, ",")
+	for i := range skills {
+		if strings.EqualFold(strings.TrimSpace(skills[i]), skill) {
+			return true
+		}
+	}
+	return false
+}
+
+// attackAbility is the ability an attack rolls with, finesse weapons taking
+// the better of Str and Dex.
+func attackAbility(char Char, att Attack) string {
+	if strings.EqualFold(att.Ability, "finesse") {
+		if char.Abilities.Dex > char.Abilities.Str {
+			return "Dex"
+		}
+		return "Str"
+	}
+	return att.Ability
+}
+
+// defaultAttackAbility is the ability for an attack written down without
+// one: Dex if it reaches past 5 feet, like a bow, and Str otherwise.
+func defaultAttackAbility(att Attack) string {
+	reach, err := strconv.Atoi(strings.SplitN(att.Range, "/", 2)[0])
+	if err == nil && reach > 5 {
+		return "Dex"
+	}
+	return "Str"
+}
+
+func derivedStat(char Char, key string, value int) int {
+	if override, ok := char.Overrides[key]; ok {
+		return override
+	}
+	return value
+}
+
+// deriveStats works out a player character's initiative, proficiency bonus,
+// passive perception, AC and attack bonuses from its abilities, level and
+// equipment. Attacks without an Ability are given one from their range so
+// that every Hitbonus follows the abilities.
+func deriveStats(char *Char) {
+	deriveEquipment(char)
+	char.ProfBonus = derivedStat(*char, overrideProfBonus, profBonusFor(char.Level))
+	char.Initiative = derivedStat(*char, overrideInitiative, abilityMod(char.Abilities.Dex))
+
+	perception := 10 + abilityMod(char.Abilities.Wis)
+	if hasSkill(*char, "Perception") {
+		perception = perception + char.ProfBonus
+	}
+	char.PassPerception = derivedStat(*char, overridePassPerception, perception)
+
+	for i := range char.Attacks {
+		if char.Attacks[i].Ability == "" {
+			char.Attacks[i].Ability = defaultAttackAbility(char.Attacks[i])
+		}
+		score := abilityScore(char.Abilities, attackAbility(*char, char.Attacks[i]))
+		char.Attacks[i].Hitbonus = abilityMod(score) + char.ProfBonus + char.Attacks[i].Magic
+	}
+}
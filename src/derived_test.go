@@ -0,0 +1,62 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestDeriveStats(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+
+	char := Char{Level: 5, Skills: "Athletics, Perception", Initiative: 7, ProfBonus: 2, Abilities: Abilities{Str: 12, Dex: 16, Wis: 13},
+		Attacks: []Attack{
+			{Name: "rapier", Ability: "finesse", Hitbonus: 1},
+			{Name: "longbow", Ability: "Dex", Magic: 1},
+			{Name: "bite", Range: "5", Hitbonus: 9},
+			{Name: "shortbow", Range: "80/320", Hitbonus: 9},
+		}}
+	deriveStats(&char)
+
+	if char.ProfBonus != 3 || char.Initiative != 3 || char.PassPerception != 14 {
+		t.Log("Expected +3 proficiency, +3 initiative and 14 passive perception but got ", char.ProfBonus, char.Initiative, char.PassPerception)
+		t.Fail()
+	}
+
+	if char.Attacks[0].Hitbonus != 6 || char.Attacks[1].Hitbonus != 7 || char.Attacks[2].Hitbonus != 4 || char.Attacks[3].Hitbonus != 6 {
+		t.Log("Expected +6, +7, +4 and +6 to hit but got ", char.Attacks)
+		t.Fail()
+	}
+}
+
+func TestDeriveStatsOverrides(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+
+	char := Char{Level: 1, Abilities: Abilities{Dex: 10, Wis: 10}, Overrides: map[string]int{"Initiative": 5}}
+	deriveStats(&char)
+
+	if char.Initiative != 5 || char.PassPerception != 10 {
+		t.Log("Expected the +5 initiative override and 10 passive perception but got ", char.Initiative, char.PassPerception)
+		t.Fail()
+	}
+}
+
+func TestDeriveStatsAttackAbility(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+
+	char := Char{Level: 1, Abilities: Abilities{Str: 8, Dex: 14},
+		Attacks: []Attack{{Name: "club", Range: "5", Hitbonus: 5}, {Name: "sling", Range: "30/120", Hitbonus: 5}}}
+	deriveStats(&char)
+	char.Abilities.Dex = 16
+	deriveStats(&char)
+
+	if char.Attacks[0].Ability != "Str" || char.Attacks[1].Ability != "Dex" {
+		t.Log("Expected the club to use Str and the sling Dex but got ", char.Attacks)
+		t.Fail()
+	}
+	if char.Attacks[0].Hitbonus != 1 || char.Attacks[1].Hitbonus != 5 {
+		t.Log("Expected +1 and +5 to hit after raising Dex but got ", char.Attacks)
+		t.Fail()
+	}
+}
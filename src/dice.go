@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// parseDice splits a dice string such as "2d6+3", "d20" or "1d4-1" into the
+// number of dice, the die size and the flat bonus. A plain number is treated
+// as a flat amount with no dice.
+func parseDice(dicestring string) (int, int, int, error) {
+	dicestring = strings.TrimSpace(dicestring)
+	num, size, bonus := 0, 0, 0
+
+	sign := 1
+	rest := dicestring
+	idx := strings.LastIndexAny(dicestring, "+-")
+	if idx > 0 {
+		if dicestring[idx] == '-' {
+			sign = -1
+		}
+		b, err := strconv.Atoi(dicestring[idx+1:])
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("bad bonus in %q", dicestring)
+		}
+		bonus = sign * b
+		rest = dicestring[:idx]
+	}
+
+	d := strings.Index(rest, "d")
+	if d == -1 {
+		flat, err := strconv.Atoi(rest)
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("bad dice string %q", dicestring)
+		}
+		return 0, 0, flat + bonus, nil
+	}
+
+	if d == 0 {
+		num = 1
+	} else {
+		n, err := strconv.Atoi(rest[:d])
+		if err != nil {
+			return 0, 0, 0, fmt.Errorf("bad number of dice in %q", dicestring)
+		}
+		num = n
+	}
+
+	s, err := strconv.Atoi(rest[d+1:])
+	if err != nil || s < 1 {
+		return 0, 0, 0, fmt.Errorf("bad die size in %q", dicestring)
+	}
+	size = s
+
+	return num, size, bonus, nil
+}
+
+// averageDice is the expected total of a dice string.
+func averageDice(dicestring string) float64 {
+	num, size, bonus, err := parseDice(dicestring)
+	if err != nil {
+		return 0
+	}
+	return float64(num)*float64(size+1)/2 + float64(bonus)
+}
+
+// rollInt rolls dicestring with the configured dice roller and returns the
+// total, or 0 if the roller gave back something unreadable.
+func rollInt(dicestring string) int {
+	dres := getDiceResults(dicestring)
+	dres = strings.TrimRight(dres, " \n")
+	roll, err := strconv.Atoi(dres)
+	if err != nil {
+		fmt.Println("Could not convert ", dres, " to int: ", err)
+		return 0
+	}
+	return roll
+}
+
+// hitChance is the probability that an attack with hitbonus hits ac, with a
+// natural 1 always missing and a natural 20 always hitting.
+func hitChance(hitbonus int, ac int) float64 {
+	p := float64(21-(ac-hitbonus)) / 20
+	if p < 0.05 {
+		return 0.05
+	}
+	if p > 0.95 {
+		return 0.95
+	}
+	return p
+}
+
+func expectedDamage(att Attack, ac int) float64 {
+	return hitChance(att.Hitbonus, ac) * averageDice(att.Damageroll)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseDice(t *testing.T) {
+	tests := []struct {
+		in               string
+		num, size, bonus int
+	}{
+		{"1d20", 1, 20, 0},
+		{"d20", 1, 20, 0},
+		{"2d6+3", 2, 6, 3},
+		{"10d8+10", 10, 8, 10},
+		{"1d4-1", 1, 4, -1},
+		{"5", 0, 0, 5},
+	}
+
+	for _, tt := range tests {
+		num, size, bonus, err := parseDice(tt.in)
+		if err != nil {
+			t.Log("Unexpected error for ", tt.in, ": ", err)
+			t.Fail()
+			continue
+		}
+		if num != tt.num || size != tt.size || bonus != tt.bonus {
+			t.Log("Expected ", tt.num, tt.size, tt.bonus, " for ", tt.in, " but got ", num, size, bonus)
+			t.Fail()
+		}
+	}
+
+	for _, bad := range []string{"", "xd6", "1d", "1d6+x"} {
+		if _, _, _, err := parseDice(bad); err == nil {
+			t.Log("Expected an error for ", bad)
+			t.Fail()
+		}
+	}
+}
+
+func TestAverageDice(t *testing.T) {
+	if avg := averageDice("2d6+3"); avg != 10 {
+		t.Log("Expected 10 for 2d6+3 but got ", avg)
+		t.Fail()
+	}
+
+	if avg := averageDice("1d12"); avg != 6.5 {
+		t.Log("Expected 6.5 for 1d12 but got ", avg)
+		t.Fail()
+	}
+}
+
+func TestHitChance(t *testing.T) {
+	if p := hitChance(5, 15); p != 0.55 {
+		t.Log("Expected 0.55 for +5 vs AC 15 but got ", p)
+		t.Fail()
+	}
+
+	// natural 1s and 20s
+	if p := hitChance(0, 30); p != 0.05 {
+		t.Log("Expected 0.05 for +0 vs AC 30 but got ", p)
+		t.Fail()
+	}
+	if p := hitChance(20, 10); p != 0.95 {
+		t.Log("Expected 0.95 for +20 vs AC 10 but got ", p)
+		t.Fail()
+	}
+}
+
+func TestBestAttack(t *testing.T) {
+	char := Char{Attacks: []Attack{
+		{Name: "dagger", Hitbonus: 8, Damageroll: "1d4+2"},
+		{Name: "maul", Hitbonus: 2, Damageroll: "2d6+4"},
+	}}
+
+	// the maul does more damage when almost everything hits
+	if best := bestAttack(char, Char{AC: 5}); best != 1 {
+		t.Log("Expected the maul against AC 5 but got ", char.Attacks[best].Name)
+		t.Fail()
+	}
+
+	// but the dagger is better when the maul mostly misses
+	if best := bestAttack(char, Char{AC: 20}); best != 0 {
+		t.Log("Expected the dagger against AC 20 but got ", char.Attacks[best].Name)
+		t.Fail()
+	}
+}
+
+func TestOtherRaceNpcs(t *testing.T) {
+	testWorld(t)
+	world.Npcs = []Char{
+		{Name: "Goblin", Key: "gob1", Race: "goblin", HP: 7, CurHP: 7},
+		{Name: "Goblin", Key: "gob2", Race: "goblin", HP: 7, CurHP: 7},
+		{Name: "Orc", Key: "orc1", Race: "orc", HP: 15, CurHP: 15},
+		{Name: "Wolf", Key: "wol1", Race: "beast", HP: 11, CurHP: 0},
+	}
+	clearFled()
+
+	others := otherRaceNpcs(world.Npcs[0])
+	if len(others) != 1 || others[0].Key != "orc1" {
+		t.Log("Expected a goblin to turn only on the live orc but got ", others)
+		t.Fail()
+	}
+}
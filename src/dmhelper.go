@@ -22,12 +22,19 @@ import (
 	"net"
 )
 
+// The DM's name on the web and secret word over telnet.
+const dmPlayername = "ohgodmedusa"
+
 var (
 	addr          = flag.String("addr", ":8080", "http service address")
 	assets        = flag.String("assets", defaultAssetPath(), "path to assets")
+	autosaveEvery = flag.Int("autosave", 10, "Autosave after this many state changing commands, 0 to turn it off.")
+	fresh         = flag.Bool("fresh", false, "Start a new world instead of resuming the autosave.")
 	homeTempl     *template.Template
 	editPlayerTempl     *template.Template
 	playerIdTempl     *template.Template
+	levelUpTempl     *template.Template
+	newCharTempl     *template.Template
 	world WorldState
 )
 
@@ -41,21 +48,34 @@ type WorldState struct {
 	ShowNpcs      bool
 	ShowMugs      bool
 	Initiativetxt string
-	Curhps        map[int]int
+	// player hit points and everyone's turn state, by Key
+	Combatants    map[string]Combatant
 	Lastoutput    string
 	Lastbattlemsg string
 	Battlelog     string
 	Outputar      []string
 	Currentturn   int
+	Round         int
+	Turnstart     time.Time
+	Lairdone      bool
 	Objects       []Object
+	Loot          map[string][]string
+	Lootcoins     map[string]int
+	Loottables    []LootTable
 	Players	      []string
 	Loggedin      []string
 	Charlist      string
 	Abilitymods   map[int]int
 	Exptable      map[int]int
 	Challtable    map[int]int
-	Loggedexp     int
+	Thresholdtable map[int][]int
+	Classes       map[string]ClassData
+	Races         map[string]RaceData
+	Combatexp     int
+	Milestone     bool
 	Music	      string
+	// campaign directory under campaigns, "" for the default campaign
+	Campaign      string
 }
 
 type MainData struct {
@@ -75,6 +95,10 @@ type Place struct {
 	Desc     string
 	Key      string
 	Autodrop []string
+	Creatures []string
+	// object keys the place has for sale
+	Shop     []string
+	LootTable string
 	Music	 string
 }
 
@@ -85,6 +109,24 @@ type Object struct {
 	Desc string
 	Contains []string
 	Weight int
+
+	// weapons
+	Damage   string
+	Dtype    string
+	Verb     string
+	Range    string
+	Finesse  bool
+	Ranged   bool
+
+	// armor is light, medium or heavy, shields just add their bonus
+	Armor    string
+	ArmorAC  int
+	DexCap   int
+	Shield   int
+
+	Magic    int
+	// such as "15 gp"
+	Price    string
 }
 
 type Char struct {
@@ -94,6 +136,9 @@ type Char struct {
 	Race       string
 	Abilities  Abilities
 	Level      int
+	XP         int
+	MilestoneLevel int
+	CR         string
 	InParty    bool
 	Image      string
 	Initiative int
@@ -104,7 +149,19 @@ type Char struct {
 	Desc       string
 	Key        string
 	Attacks    []Attack
+	Multiattack []Multiattack
+	Legendary  int
+	LegendaryActions []LegendaryAction
+	LairActions []LairAction
+	Strategy   string
+	FleeAt     int
+	Tags       []string
 	Inventory  []string
+	Equipped   []string
+	Purse      Purse
+	LootTable  string
+	// an NPC whose things have already been left for the players
+	Looted     bool
 
 
 	// extra fields for player character
@@ -132,9 +189,11 @@ type Char struct {
 	SpellL7 string
 	SpellL8 string
 	SpellL9 string
+	Overrides map[string]int
 	AttacksJson string
 	AbilitiesJson string
 	InventoryJson string
+	OverridesJson string
 	Playername string
 }
 
@@ -145,6 +204,12 @@ type Attack struct {
 	Verb       string
 	Hitbonus   int
 	Damageroll string
+	// for player characters, Str, Dex, finesse or another ability to work
+	// out Hitbonus from, plus any magic bonus
+	Ability    string
+	Magic      int
+	// key of the equipped object this attack comes from
+	Item       string
 }
 
 type Abilities struct {
@@ -160,9 +225,11 @@ func (char *Char) JsonIfy() {
 	jsonatt,_ := json.Marshal(char.Attacks)
 	jsoninv,_ := json.Marshal(char.Inventory)
 	jsonabi,_ := json.Marshal(char.Abilities)
+	jsonover,_ := json.Marshal(char.Overrides)
 	char.AttacksJson = template.HTMLEscapeString(string(jsonatt))
 	char.InventoryJson = template.HTMLEscapeString(string(jsoninv))
 	char.AbilitiesJson = template.HTMLEscapeString(string(jsonabi))
+	char.OverridesJson = template.HTMLEscapeString(string(jsonover))
 
 	//fmt.Println(char.AttacksJson)
 }
@@ -248,6 +315,12 @@ func prefixExists(prefix string) bool {
 			return true
 		}
 	}
+	// instances are out of world.Chars while it is rebuilt
+	for i := range world.Npcs {
+		if world.Npcs[i].Key == prefix {
+			return true
+		}
+	}
 	return false
 }
 
@@ -276,28 +349,26 @@ func makeCharKey(name string) string {
 
 }
 
-func logExp(level int) {
-	sendConsole(fmt.Sprintln("Players ", len(world.Players), " exp is ", world.Challtable[level]))
-	world.Loggedexp = world.Loggedexp + (world.Challtable[level] / len(world.Players))
-	sendConsole(fmt.Sprintln("Exp: ", world.Loggedexp))
+// logExp adds a defeated NPC to the XP shared out at endcombat.
+func logExp(char Char) {
+	xp := challengeXP(char)
+	world.Combatexp = world.Combatexp + xp
+	sendConsole(fmt.Sprintln(char.Name, " is worth ", xp, " exp, combat exp: ", world.Combatexp))
 }
 
 func applyDamage(char Char, damage int) {
 	if charIsNpc(char.Name) {
 		for i := range world.Npcs {
 			if char.Key == world.Npcs[i].Key {
+				wasup := world.Npcs[i].CurHP > 0
 				world.Npcs[i].CurHP = world.Npcs[i].CurHP - damage
-				if world.Npcs[i].CurHP <= 0 {
-					logExp(world.Npcs[i].Level)
+				if wasup && world.Npcs[i].CurHP <= 0 {
+					logExp(world.Npcs[i])
 				}
 			}
 		}
 	} else {
-		for i := range world.Chars {
-			if world.Chars[i].Name == char.Name {
-				world.Curhps[i] = world.Curhps[i] - damage
-			}
-		}
+		setCharHP(char.Key, getCharHP(char.Key)-damage)
 	}
 }
 
@@ -309,10 +380,10 @@ func ReadFileContents(file *os.File) []byte {
 
 func initPlaces() {
 
-	file, err := os.Open("assets/places.json")
+	file, err := os.Open(assetPath("places.json"))
 
 	if err != nil {
-		panic("Could not open assets/places.json")
+		panic(fmt.Sprintf("Could not open %s", assetPath("places.json")))
 	}
 
 	filebytes := ReadFileContents(file)
@@ -320,7 +391,7 @@ func initPlaces() {
 	world.Places = make([]Place, 30)
 	err = json.Unmarshal(filebytes, &world.Places)
 	if err != nil {
-		fmt.Println("Failed to read assets/places.json: ", err)
+		fmt.Println("Failed to read ", assetPath("places.json"), ": ", err)
 		panic(err)
 	}
 
@@ -328,10 +399,10 @@ func initPlaces() {
 }
 
 func initObjects() {
-	file, err := os.Open("assets/objects.json")
+	file, err := os.Open(assetPath("objects.json"))
 
 	if err != nil {
-		panic("Could not open assets/objects.json")
+		panic(fmt.Sprintf("Could not open %s", assetPath("objects.json")))
 	}
 
 	filebytes := ReadFileContents(file)
@@ -342,7 +413,7 @@ func initObjects() {
 
 	err = json.Unmarshal(filebytes, &world.Objects)
 	if err != nil {
-		fmt.Println("Failed to read assets/objects.json: ", err)
+		fmt.Println("Failed to read ", assetPath("objects.json"), ": ", err)
 		panic(err)
 	}
 
@@ -412,6 +483,7 @@ func cloneChar(char Char) Char {
 	nchar.Race = char.Race
 	nchar.Abilities = char.Abilities
 	nchar.Level = char.Level
+	nchar.CR = char.CR
 	nchar.InParty = char.InParty
 	nchar.Image = char.Image
 	nchar.Initiative = char.Initiative
@@ -421,47 +493,55 @@ func cloneChar(char Char) Char {
 	nchar.CurHP = char.HP
 	nchar.Desc = char.Desc
 	nchar.Key = makeCharKey(char.Name)
-	nchar.Attacks = char.Attacks
-	nchar.Inventory = char.Inventory
+	nchar.Attacks = append([]Attack(nil), char.Attacks...)
+	nchar.Multiattack = char.Multiattack
+	nchar.Legendary = char.Legendary
+	nchar.LegendaryActions = char.LegendaryActions
+	nchar.LairActions = char.LairActions
+	nchar.Strategy = char.Strategy
+	nchar.FleeAt = char.FleeAt
+	// each instance carries its own things
+	nchar.Tags = append([]string(nil), char.Tags...)
+	nchar.Inventory = append([]string(nil), char.Inventory...)
+	nchar.Equipped = append([]string(nil), char.Equipped...)
+	nchar.LootTable = char.LootTable
 
 	return nchar
 }
 
 func initChars(wipehps bool) {
 
-	file, err := os.Open("assets/chars.json")
+	file, err := os.Open(assetPath("chars.json"))
 
 	if err != nil {
-		panic("Could not open assets/chars.json")
+		panic(fmt.Sprintf("Could not open %s", assetPath("chars.json")))
 	}
 
 	filebytes := ReadFileContents(file)
 	//if chars == nil {
-	world.Chars = make([]Char, 30)
+	chars := make([]Char, 30)
 	//nchars = make([]Char,30)
 	//}
-	err = json.Unmarshal(filebytes, &world.Chars)
+	err = json.Unmarshal(filebytes, &chars)
 	if err != nil {
-		fmt.Println("Failed to read assets/chars.json: ", err)
+		fmt.Println("Failed to read ", assetPath("chars.json"), ": ", err)
 		panic(err)
 	}
 
 	for i := range world.Players {
 		char := loadPlayerChar(world.Players[i])
 		char.Playername = world.Players[i]
+		deriveStats(&char)
 		fmt.Println("Loaded ", char.Name)
-		world.Chars = append(world.Chars,char)
+		chars = append(chars,char)
 	}
 
-	//if curhps != nil {
-	//	curhps = make(map[int]int)
-	//}
+	carryKeys(chars, world.Chars)
 
 	for i := range world.Chars {
-		if wipehps {
-			world.Curhps[i] = world.Chars[i].HP
+		if _, ok := world.Combatants[world.Chars[i].Key]; wipehps || !ok {
+			setCharHP(world.Chars[i].Key, world.Chars[i].HP)
 		}
-		world.Chars[i].Key = makeCharKey(world.Chars[i].Name)
 
 		/*if chars[i].NpcInstances > 0 {
 			for k := 0; k <= chars[i].NpcInstances; k++ {
@@ -496,7 +576,7 @@ func alreadyLoggedIn(playername string) bool {
 }
 
 func validatePlayer(player string) bool {
-	if player == "ohgodmedusa" {
+	if player == dmPlayername {
 		return true
 	}
 
@@ -515,6 +595,16 @@ func validatePlayer(player string) bool {
 	return false
 }
 
+// cookiePlayer is the lower case player name in the request's cookie, or
+// "" if it has none.
+func cookiePlayer(req *http.Request) string {
+	cv, err := req.Cookie("playername")
+	if err != nil || cv == nil {
+		return ""
+	}
+	return strings.ToLower(cv.Value)
+}
+
 func homeHandler(c http.ResponseWriter, req *http.Request) {
 
 	req.ParseForm()
@@ -523,12 +613,26 @@ func homeHandler(c http.ResponseWriter, req *http.Request) {
 	//		http.SetCookie(c,&http.Cookie{Name: "playername", Value: "", MaxAge: -1})
 	//}
 
-	if (cv == nil || cv.Value == "") && len(req.Form["playername"]) == 0 {
+	// new players don't have a character to log in with yet
+	if strings.Contains(req.URL.Path, "newchar") {
+		newCharHandler(c, req)
+		return
+	}
+
+	// only the login page is open without a cookie
+	if (cv == nil || cv.Value == "") && !strings.Contains(req.URL.Path, "playerid") {
 		playerIdTempl.Execute(c,nil)
 		return
 	}
 
 
+	// players of another campaign have to identify again
+	if cv != nil && cv.Value != "" && !inCampaign(cv.Value) && !strings.Contains(req.URL.Path, "assets") && !strings.Contains(req.URL.Path, "playerid") {
+		http.SetCookie(c,&http.Cookie{Name: "playername", Value: "", MaxAge: -1})
+		playerIdTempl.Execute(c,nil)
+		return
+	}
+
 	if strings.Contains(req.URL.Path, "assets") {
 		//fmt.Println("Serving assets...")
 		chttp.ServeHTTP(c, req)
@@ -540,6 +644,14 @@ func homeHandler(c http.ResponseWriter, req *http.Request) {
 		issueAttack(c, req)
 	} else if strings.Contains(req.URL.Path, "char") {
 		webViewChar(c, req)
+	} else if strings.Contains(req.URL.Path, "shop") {
+		shopHandler(c, req)
+	} else if strings.Contains(req.URL.Path, "claim") {
+		claimHandler(c, req)
+	} else if strings.Contains(req.URL.Path, "history") {
+		historyHandler(c, req)
+	} else if strings.Contains(req.URL.Path, "levelup") {
+		levelUpHandler(c, req)
 	} else if strings.Contains(req.URL.Path, "playeredit") {
 		fmt.Println("Player edit...")
 		editPlayerChar(c, req)
@@ -618,27 +730,14 @@ func getNpcTxt() string {
 func renderChar(char Char) string {
 	output := ""
 	if charIsNpc(char.Name) {
-		wounded := ""
-		perc := float32(char.CurHP)/float32(char.HP)
-		//fmt.Println("Perc: ", perc)
-		if perc == 1.0 {
-			wounded = ""
-		} else if perc > 0.80 {
-			wounded = "green"
-		} else if perc > 0.30 {
-			wounded = "yellow"
-		} else if perc < 0.30 {
-			wounded = "red"
-		}
-
-
+		wounded := woundedColor(char)
 		if char.CurHP <= 0 {
 			char.Image = "/assets/skull.jpg"
 		}
 		output = fmt.Sprintf("<div class=\"npc\"><a href=\"/char?name=%s\"><img src=\"%s\" width=180/></a><br><b><span style=\"color: %s\">%s (%s)</span></b><br>%s</div>  ", char.Name, char.Image, wounded, char.Name, char.Key, char.Race)
 	} else {
 		curhp := getHP(char.Key)
-		output = fmt.Sprintf("<div id=\"%s\" class=\"partymember\"><div><a href=\"/char?name=%s\"><img src=\"%s\" width=180/></a></div><b>%s</b><br>%s/%s/%d<br>%d/%d   </div>", char.Name, char.Name, char.Image, char.Name, char.Race, char.Class, char.Level, curhp, char.HP)
+		output = fmt.Sprintf("<div id=\"%s\" class=\"partymember\"><div><a href=\"/char?name=%s\"><img src=\"%s\" width=180/></a></div><b>%s</b><br>%s/%s/%d<br>%d/%d%s%s   </div>", char.Name, char.Name, char.Image, char.Name, char.Race, char.Class, char.Level, curhp, char.HP, renderLevelUp(char), renderEncumbrance(char))
 	}
 	return output
 }
@@ -668,7 +767,7 @@ func renderParty() string {
 	}
 
 	for i := range world.Chars {
-		curhp := world.Curhps[i]
+		curhp := getCharHP(world.Chars[i].Key)
 		if world.Chars[i].InParty {
 
 			if curhp < 0 {
@@ -679,7 +778,7 @@ func renderParty() string {
 				//output = output + fmt.Sprintf("<div id=\"%s\" class=\"partymember\"><div><a href=\"/char?name=%s\"><img src=\"%s\" width=180/></a></div><b>%s</b><br>%s/%s/%d<br>%d/%d   </div>", chars[i].Name, chars[i].Name, chars[i].Image, chars[i].Name, chars[i].Race, chars[i].Class, chars[i].Level, curhp, chars[i].HP)
 				output = output + renderChar(world.Chars[i])
 			} else {
-				output = output + fmt.Sprintf("<div id=\"%s\" class=\"partymembernoimg\"><b>%s</b><br>%s/%s/%d<br>%d/%d   </div>", world.Chars[i].Name, world.Chars[i].Name, world.Chars[i].Race, world.Chars[i].Class, world.Chars[i].Level, curhp, world.Chars[i].HP)
+				output = output + fmt.Sprintf("<div id=\"%s\" class=\"partymembernoimg\"><b>%s</b><br>%s/%s/%d<br>%d/%d%s%s   </div>", world.Chars[i].Name, world.Chars[i].Name, world.Chars[i].Race, world.Chars[i].Class, world.Chars[i].Level, curhp, world.Chars[i].HP, renderLevelUp(world.Chars[i]), renderEncumbrance(world.Chars[i]))
 			}
 		}
 	}
@@ -695,7 +794,7 @@ func renderContent(msg string, cmd *Command) string {
 		imagetxt = fmt.Sprintf("<script type=\"text/javascript\">$(\"#picture\").text(\"\");$(\"#picture\").append(\"<img height=1000 src='%s'/>\");", cplace.Image)
 	}
 
-	if world.Initiativetxt != "" && cmd.Name != "v" && cmd.Name != "vo" && cmd.Name != "blog" && cmd.Name != "att" && cmd.Name != "ant" && cmd.Name != "msg" {
+	if world.Initiativetxt != "" && cmd.Name != "v" && cmd.Name != "vo" && cmd.Name != "blog" && cmd.Name != "att" && cmd.Name != "ant" && cmd.Name != "act" && cmd.Name != "la" && cmd.Name != "msg" {
 	//if world.Initiativetxt != "" && cmd.Name != "v" && cmd.Name != "vo" && cmd.Name != "blog" {
 		world.Initiativetxt = renderInitiativeTxt(world.Outputar)
 		//msg = fmt.Sprintf("<div id=\"initiative\"><span id=\"initiativetxt\">%s   <audio autoplay loop><source src=\"/assets/fight_real.ogg\" type=\"audio/ogg\">Your browser does not support the audio element.</audio> </span></div><div id=\"msgtxt\">%s</div>", world.Initiativetxt, msg)
@@ -703,14 +802,14 @@ func renderContent(msg string, cmd *Command) string {
 	}
 
 	placedesc := cplace.Desc
-	npctxt := getNpcTxt()
+	npctxt := getNpcTxt() + renderLoot() + renderShopLink()
 	content := ""
-	if cmd.Name == "att" || cmd.Name == "ant" {
+	if cmd.Name == "att" || cmd.Name == "ant" || cmd.Name == "act" || cmd.Name == "la" {
 		cchar := getCharAttacker(msg)
 		//cchar := getCharTurn(currentturn-1)
 		//tchar := getCharTarget(msg)
 		tchar := Char{}
-		if len(cmd.Args) == 0 {
+		if len(cmd.Args) == 0 || cmd.Name == "act" || cmd.Name == "la" {
 			tchar = getCharTarget(msg)
 		} else {
 			tchar = getNpcOrChar(cmd.Args[1])
@@ -865,6 +964,11 @@ func getLocalDiceResults(dicestring string) string {
 }
 
 func getDiceResults(dicestring string) string {
+	// seeded roller for simulations
+	if simRand != nil {
+		return rollSimDice(simRand, dicestring)
+	}
+
 	// local system spawn with dicer roller
 	return getLocalDiceResults(dicestring)
 
@@ -886,15 +990,15 @@ func charIsNpc(name string) bool {
 }
 
 func renderInitiativeTxt(ar []string) string {
-	output := ""
+	output := renderRoundTxt()
 	for i := range world.Outputar {
 		if ar[i] == "" {
 			continue;
 		}
 		if i == world.Currentturn {
-			output = fmt.Sprintf("%s<span id=\"currentturn\">%s</span><br>", output, ar[i])
+			output = fmt.Sprintf("%s<span id=\"currentturn\">%s</span>%s<br>", output, ar[i], renderLegendary(ar[i]))
 		} else {
-			output = fmt.Sprintf("%s%s<br>", output, ar[i])
+			output = fmt.Sprintf("%s%s%s<br>", output, ar[i], renderLegendary(ar[i]))
 		}
 	}
 
@@ -965,7 +1069,7 @@ func rollInitiatives(advantages string) string {
 		if world.Chars[i].InParty || charIsNpc(world.Chars[i].Name) {
 			_,e := alreadyrolled[world.Chars[i].Name]
 			if e == true {
-				fmt.Println("Already rolled for", world.Chars[i].Name)
+				sendConsole(fmt.Sprintln("Already rolled for", world.Chars[i].Name))
 				continue
 			}
 			sendConsole(fmt.Sprintln("Rolling init for...", world.Chars[i].Name))
@@ -1030,6 +1134,10 @@ func rollInitiatives(advantages string) string {
 	}
 
 	world.Currentturn = 0
+	world.Round = 0
+	clearActions()
+	clearLegendary()
+	clearFled()
 	nextTurn()
 	output = renderInitiativeTxt(world.Outputar)
 
@@ -1120,7 +1228,7 @@ func viewCharConsole(name string) string {
 func viewObj(key string) string {
 	output := ""
 	obj := getObject(key)
-	output = fmt.Sprintf("<div id=\"viewobj\"><img id=\"objimg\" src=\"%s\"/></div><div id=\"objinfo\"><p>%s</p><p>%s</p>",  obj.Image, obj.Name, obj.Desc)
+	output = fmt.Sprintf("<div id=\"viewobj\"><img id=\"objimg\" src=\"%s\"/></div><div id=\"objinfo\"><p>%s</p><p>%s</p>%s<p>Weight: %d lb</p>%s",  obj.Image, obj.Name, obj.Desc, objStats(obj), objectWeight(obj.Key), renderContents(obj, 0))
 	return output
 }
 
@@ -1137,13 +1245,23 @@ func viewChar(name string, showstats bool) string {
 	inventory := "<br>Inventory<br>"
 	for i := range char.Inventory {
 		obj := getObject(char.Inventory[i])
-		inventory = inventory + obj.Name + " (" + obj.Key + ")<br>"
+		inventory = inventory + obj.Name + " (" + obj.Key + ")"
+		if hasItem(char.Equipped, obj.Key) {
+			inventory = inventory + " equipped"
+		}
+		inventory = inventory + "<br>"
+	}
+	inventory = inventory + fmt.Sprintf("Coins: %d pp %d gp %d ep %d sp %d cp<br>", char.Purse.PP, char.Purse.GP, char.Purse.EP, char.Purse.SP, char.Purse.CP)
+	inventory = inventory + fmt.Sprintf("Carrying %d/%d lb", carriedWeight(char), carryingCapacity(char))
+	if level := encumbrance(char); level != unencumbered {
+		inventory = inventory + ", " + encumbranceName(level)
 	}
+	inventory = inventory + "<br>"
 
 	if showstats {
 
 		output = fmt.Sprintf("<div id=\"viewchar\"><img id=\"charimg\" src=\"%s\"/></div><div id=\"charinfo\"><p>%s, Level %d %s</p><p>%s</p>Str: %d (%d) Dex: %d (%d) Con: %d (%d) Int: %d (%d) Wis: %d (%d) Cha: %d (%d) <br>Initiative: %d<br>AC: %d<br>HP: %d<br>Alignment: %s<br>Attacks:<br> %s%s", char.Image, char.Name, char.Level, char.Class, char.Desc, char.Abilities.Str, world.Abilitymods[char.Abilities.Str], char.Abilities.Dex, world.Abilitymods[char.Abilities.Dex], char.Abilities.Con, world.Abilitymods[char.Abilities.Con], char.Abilities.Int, world.Abilitymods[char.Abilities.Int], char.Abilities.Wis, world.Abilitymods[char.Abilities.Wis], char.Abilities.Cha, world.Abilitymods[char.Abilities.Cha], char.Initiative, char.AC, char.HP, char.Alignment, attacks, inventory)
-		output = output + fmt.Sprintf("<hr>Inspiration: %d<br> Proficiency Bonus: %d<br> Passive Perception: %d<br> Hit Dice: %s<br> Speed: %d<br> Skills: %s<br><hr>Misc Proficiencies and Languages: %s<br> Personality Traits: %s<br> Ideals: %s<br> Bonds: %s<br> Flaws: %s<br> Features and Traits: %s<br> Treasure: %s<br> Spells<br> Level 0: %s<br> Level 1: %s<br> Level 2: %s<br> Level 3: %s<br> Level 4: %s<br> Level 5: %s<br> Level 6: %s<br> Level 7: %s<br> Level 8: %s<br> Level 9: %s<br> </div>", char.Inspiration, char.ProfBonus, char.PassPerception, char.HitDice, char.Speed, char.Skills, char.MiscProfLanguages, char.PersonalityTraits, char.Ideals, char.Bonds, char.Flaws, char.FeaturesTraits, char.Treasure, char.SpellL0, char.SpellL1, char.SpellL2, char.SpellL3, char.SpellL4, char.SpellL5, char.SpellL6, char.SpellL7, char.SpellL8, char.SpellL9)
+		output = output + fmt.Sprintf("<hr>Inspiration: %d<br> Proficiency Bonus: %d<br> Passive Perception: %d<br> Hit Dice: %s<br> Speed: %d<br> Skills: %s<br><hr>Misc Proficiencies and Languages: %s<br> Personality Traits: %s<br> Ideals: %s<br> Bonds: %s<br> Flaws: %s<br> Features and Traits: %s<br> Treasure: %s<br> Spells<br> Level 0: %s<br> Level 1: %s<br> Level 2: %s<br> Level 3: %s<br> Level 4: %s<br> Level 5: %s<br> Level 6: %s<br> Level 7: %s<br> Level 8: %s<br> Level 9: %s<br> </div>", char.Inspiration, char.ProfBonus, char.PassPerception, char.HitDice, effectiveSpeed(char), char.Skills, char.MiscProfLanguages, char.PersonalityTraits, char.Ideals, char.Bonds, char.Flaws, char.FeaturesTraits, char.Treasure, char.SpellL0, char.SpellL1, char.SpellL2, char.SpellL3, char.SpellL4, char.SpellL5, char.SpellL6, char.SpellL7, char.SpellL8, char.SpellL9)
 	} else {
 		output = fmt.Sprintf("<div id=\"viewchar\"><img id=\"charimg\" src=\"%s\"/></div><div id=\"charinfo\"><p>%s</p><p>%s</p>", char.Image, char.Name, char.Desc)
 	}
@@ -1182,6 +1300,10 @@ func dropNpc(name string) {
 	nchar := cloneChar(getChar(name))
 	world.Chars = append(world.Chars, nchar)
 	world.Npcs = append(world.Npcs, nchar)
+	// combat has already handed out legendary points
+	if inCombat() && nchar.Legendary > 0 {
+		setLegendary(nchar.Key, nchar.Legendary)
+	}
 	sendConsole(fmt.Sprintln("Dropped ", nchar.Key))
 }
 
@@ -1195,19 +1317,16 @@ func setHP(name string, hp int) {
 	if charIsNpc(name) {
 		for i := range world.Npcs {
 			if name == world.Npcs[i].Key {
+				wasup := world.Npcs[i].CurHP > 0
 				world.Npcs[i].CurHP = hp
 				//fmt.Println(hp)
-				if hp <= 0 {
-					logExp(world.Npcs[i].Level)
+				if wasup && hp <= 0 {
+					logExp(world.Npcs[i])
 				}
 			}
 		}
 	} else {
-		for i := range world.Chars {
-			if world.Chars[i].Key == name {
-				world.Curhps[i] = hp
-			}
-		}
+		setCharHP(name, hp)
 	}
 }
 
@@ -1219,33 +1338,51 @@ func getHP(name string) int {
 			}
 		}
 	} else {
-		for i := range world.Chars {
-			if world.Chars[i].Key == name {
-				return world.Curhps[i]
-			}
-		}
+		return getCharHP(name)
 	}
 
 	return 0
 }
 
 func nextTurn() {
+	if inCombat() && world.Currentturn > 0 {
+		endTurn()
+	}
+
+	newround := false
 	if world.Currentturn < len(world.Outputar)-1 {
+		if world.Currentturn == 0 {
+			newround = true
+		}
 		world.Currentturn++
 	} else {
 		world.Currentturn = 1
+		newround = true
+	}
+
+	if inCombat() {
+		if newround {
+			startRound()
+		}
+		startTurn()
 	}
 }
 
 func prevTurn() {
 	if world.Currentturn > 1 {
 		world.Currentturn--
+		world.Turnstart = time.Now()
 	}
 }
 
 func printStatus() {
 	sendConsole(fmt.Sprintln("Place: ", world.Place))
-	sendConsole(fmt.Sprintln("Exp: ", world.Loggedexp))
+	sendConsole(fmt.Sprintln("Combat exp: ", world.Combatexp))
+	if world.Round > 0 {
+		sendConsole(fmt.Sprintln("Round: ", world.Round, " turn time: ", turnElapsed()))
+		cchar := getCharWithTurn()
+		sendConsole(fmt.Sprintln("Turn: ", cchar.Name, " used: ", renderActionUsage(cchar)))
+	}
 	listNpcs()
 	if world.Initiativetxt != "" {
 		sendConsole(fmt.Sprintln(world.Initiativetxt))
@@ -1255,7 +1392,7 @@ func printStatus() {
 func getCharWithTurn() Char {
 	//for i := range outputar {
 		//sendConsole(fmt.Sprintln("Current turn: ", world.Currentturn))
-		if len(world.Outputar) == 0 {
+		if world.Currentturn >= len(world.Outputar) {
 			return Char{}
 		}
 		parts := strings.Split(world.Outputar[world.Currentturn]," ")
@@ -1292,96 +1429,39 @@ func getCharWithTurn() Char {
 		sendConsole(fmt.Sprintln("Failed to lookup anything with ", world.Outputar[world.Currentturn]))
 	//}
 
-	return world.Npcs[0]
-
-}
-
-func getRandomNpc() Char {
-	if len(world.Npcs) == 1 {
-		return world.Npcs[0]
-	}
-
-	for {
-		dres := getDiceResults(fmt.Sprintf("1d%d",len(world.Npcs)))
-		dres = strings.TrimRight(dres, " \n")
-		ran, _ := strconv.Atoi(dres)
-		if len(world.Npcs) == 0 {
-			return Char{}
-		}
-		if world.Npcs[ran-1].CurHP > 0 {
-			return world.Npcs[ran-1]
-		}
+	if len(world.Npcs) == 0 {
+		return Char{}
 	}
-}
-
-func getRandomPartyCharOrOtherRace(race string) Char {
-	// haha this is crazy
-	for {
-		dres1 := getDiceResults("1d10")
-		dres1 = strings.TrimRight(dres1, " \n")
-		ran1, _ := strconv.Atoi(dres1)
-
-
-		attacknonrace := false
-		if ran1 < 5 {
-			attacknonrace = true
-		}
-
-		dres := getDiceResults(fmt.Sprintf("1d%d",len(world.Players)))
-		dres = strings.TrimRight(dres, " \n")
-		ran, _ := strconv.Atoi(dres)
-
-		for i := range world.Chars {
-			if attacknonrace && world.Chars[i].Race != race && charIsNpc(world.Chars[i].Key) {
-				fmt.Println("ATTACKING NON RACE CHAR!",world.Chars[i].Key, charIsNpc(world.Chars[i].Key))
-				return world.Chars[i]
-			} else if world.Chars[i].Playername == world.Players[ran-1] && getHP(world.Chars[i].Key) > 0 {
-				return world.Chars[i]
-			}
-		}
-	}
-
+	return world.Npcs[0]
 
 }
 
-func getRandomPartyChar() Char {
-
-
-	// haha this is crazy
-	for {
-		dres := getDiceResults(fmt.Sprintf("1d%d",len(world.Players)))
-		dres = strings.TrimRight(dres, " \n")
-		ran, _ := strconv.Atoi(dres)
-
-		for i := range world.Chars {
-			if world.Chars[i].Playername == world.Players[ran-1] && getHP(world.Chars[i].Key) > 0 {
-				return world.Chars[i]
-			}
+// getNpcInstance is the NPC instance with key as the world has it now.
+func getNpcInstance(key string) (Char, bool) {
+	for i := range world.Npcs {
+		if world.Npcs[i].Key == key {
+			return world.Npcs[i], true
 		}
 	}
-
-
-	return Char{}
+	return Char{}, false
 }
 
-func getNumNpcInstances(charname string) int {
-	count := 0
+func getNpcInstances(charname string) []Char {
+	instances := make([]Char, 0)
 	for i := range world.Npcs {
-		if world.Npcs[i].Name == charname && world.Npcs[i].CurHP > 0 {
-			count++
+		if world.Npcs[i].Name == charname && world.Npcs[i].CurHP > 0 && !getCombatant(world.Npcs[i].Key).Fled {
+			instances = append(instances, world.Npcs[i])
 		}
 	}
 
-	return count
+	return instances
 }
 
 func allpdead() bool {
-	for i := range world.Players {
-		for k := range world.Chars {
-			if world.Chars[k].Playername == world.Players[i] && getHP(world.Chars[k].Key) > 0 {
-				sendConsole(fmt.Sprintln(world.Chars[k].Key, " is not dead yet."))
-				return false
-			}
+	for k := range world.Chars {
+		if world.Chars[k].InParty && getHP(world.Chars[k].Key) > 0 {
+			sendConsole(fmt.Sprintln(world.Chars[k].Key, " is not dead yet."))
+			return false
 		}
 	}
 
@@ -1390,7 +1470,7 @@ func allpdead() bool {
 
 func allndead() bool {
 	for i := range world.Npcs {
-		if world.Npcs[i].CurHP > 0 {
+		if world.Npcs[i].CurHP > 0 && !getCombatant(world.Npcs[i].Key).Fled {
 			return false
 		}
 	}
@@ -1400,89 +1480,141 @@ func allndead() bool {
 }
 
 
+// autoFight fights until one side is down or combat ends, straight
+// through with no pauses, for simulations.
 func autoFight() string {
+	return runAutoFight(func(step func()) { step() }, func(bool) bool { return true }, func() bool { return false })
+}
+
+// runAutoFight is the autoFight loop. Everything it does to the world goes
+// through run, so autof can hand each step to the processor and leave the
+// world free while it pauses for the table to read the result. pause is
+// told whether it follows an action or a new turn, and stops the fight by
+// returning false. Since the DM may end combat or stop the fight between
+// steps, every step checks inCombat and stopped before it does anything.
+func runAutoFight(run func(func()), pause func(action bool) bool, stopped func() bool) string {
 	for {
-		msg := ""
-		cmd := &Command{}
+		cchar := Char{}
+		npcs := make([]Char, 0)
+		over := false
+		run(func() {
+			if stopped() {
+				over = true
+				return
+			}
+			// the DM may have ended combat while we paused
+			if !inCombat() {
+				sendConsole(fmt.Sprintln("Not in combat, exiting autof."))
+				over = true
+				return
+			}
+			cchar = getCharWithTurn()
+			if !cchar.InParty {
+				npcs = getNpcInstances(cchar.Name)
+				sendConsole(fmt.Sprintln("Num instances for", cchar.Name, " is ", len(npcs)))
+			}
+		})
+		if over {
+			return ""
+		}
 
-		cchar := getCharWithTurn()
 		if !cchar.InParty {
-			numNpcs := getNumNpcInstances(cchar.Name)
-			sendConsole(fmt.Sprintln("Num instances for", cchar.Name, " is ", numNpcs))
-
-			AT: for i := 0; i < numNpcs; i++ {
-				cmd = parseInput("deriv","ant");
-				msg = autoAttack()
-				world.Lastoutput = renderContent(msg, cmd)
-				h.broadcast <- []byte(world.Lastoutput)
-				time.Sleep(2000 * time.Millisecond)
-
-				if allpdead() {
-					break AT
+			for i := range npcs {
+				pdead := false
+				run(func() {
+					if stopped() || !inCombat() {
+						over = true
+						return
+					}
+					// it may have been hurt or cleared since the turn began
+					npc, ok := getNpcInstance(npcs[i].Key)
+					if !ok {
+						return
+					}
+					showAutoFight(autoAttackWith(npc), parseInput("deriv","ant"))
+					pdead = allpdead()
+				})
+				if over || !pause(true) {
+					return ""
+				}
+
+				if pdead {
+					break
 				}
 			}
 		} else {
-			cmd = parseInput("deriv","ant");
-			msg = autoAttack()
-			world.Lastoutput = renderContent(msg, cmd)
-			h.broadcast <- []byte(world.Lastoutput)
-			time.Sleep(2000 * time.Millisecond)
+			run(func() {
+				if stopped() || !inCombat() {
+					over = true
+					return
+				}
+				showAutoFight(autoAttack(), parseInput("deriv","ant"))
+			})
+			if over || !pause(true) {
+				return ""
+			}
 		}
 
+		run(func() {
+			if stopped() || !inCombat() {
+				over = true
+				return
+			}
 
-		msg = ""
-		nextTurn()
-		cmd = parseInput("deriv","nt");
-		world.Lastoutput = renderContent(msg, cmd)
-		h.broadcast <- []byte(world.Lastoutput)
-		time.Sleep(100 * time.Millisecond)
-
-
-		if len(world.Outputar) == 0 {
-			sendConsole("Ending combat.")
-			return ""
-		}
+			if allpdead() {
+				sendConsole(fmt.Sprintln("All players dead, exiting autof."))
+				over = true
+				return
+			}
 
-		if allpdead() {
-			sendConsole(fmt.Sprintln("All players dead, exiting autof."))
-			return ""
-		}
+			if allndead() {
+				sendConsole(fmt.Sprintln("All world.Npcs dead, exiting autof."))
+				over = true
+				return
+			}
 
+			nextTurn()
+			showAutoFight("", parseInput("deriv","nt"))
 
+			if len(world.Outputar) == 0 {
+				sendConsole("Ending combat.")
+				over = true
+			}
 
-		if allndead() {
-			sendConsole(fmt.Sprintln("All world.Npcs dead, exiting autof."))
+			if headless && world.Round > simMaxRounds {
+				over = true
+			}
+		})
+		if over || !pause(false) {
 			return ""
 		}
+	}
+}
 
+// showAutoFight broadcasts an autoFight step. Simulations skip it.
+func showAutoFight(msg string, cmd *Command) {
+	if headless {
+		return
 	}
+	logEvent(eventType(cmd.Name), cmd.Name, nil, msg)
+	showWorld(msg, cmd)
 }
 
 func autoAttack() string {
+	return autoAttackWith(getCharWithTurn())
+}
+
+func autoAttackWith(cchar Char) string {
 	msg := ""
-	cchar := getCharWithTurn()
 	hp := getHP(cchar.Key)
 	if cchar.InParty && hp > 0 {
-		randomNpc := getRandomNpc()
-		if randomNpc.CurHP <= 0 {
-			sendConsole(fmt.Sprintln("Target npc is dead!", randomNpc.CurHP, randomNpc.Key))
-		} else {
-			msg = attack(cchar, 0, randomNpc, "")
-			//nextTurn()
-		}
+		msg = autoActions(cchar)
 	} else if cchar.InParty && hp < 0 {
 		sendConsole(fmt.Sprintln("Source is dead!"))
 		msg = cchar.Name + " is dead."
 		//nextTurn()
 	} else if cchar.CurHP >= 0 && charIsNpc(cchar.Key) {
-		randomChar := getRandomPartyCharOrOtherRace(cchar.Race)
-		thp := getHP(randomChar.Key)
-		if thp <= 0 {
-			sendConsole(fmt.Sprintln("Target player/npc is dead!", thp, randomChar.Name))
-		} else {
-			msg = attack(cchar, 0, randomChar, "")
-			//nextTurn()
-		}
+		msg = autoActions(cchar)
 	} else {
 		sendConsole(fmt.Sprintln("Source is dead!"))
 		msg = cchar.Name + " is dead."
@@ -1495,6 +1627,12 @@ func autoAttack() string {
 func executeCommand(cmd Command) string {
 	msg := ""
 
+	if undoableCommands[cmd.Name] {
+		before := takeSnapshot()
+		defer recordUndo(cmd, before, commandFiles(cmd))
+		defer autosave()
+	}
+
 		if (cmd.Name == "roll" || cmd.Name == "r") && len(cmd.Args) >= 1 {
 			diceresults := getDiceResults(cmd.Args[0])
 			if len(cmd.Args) == 2 {
@@ -1506,14 +1644,41 @@ func executeCommand(cmd Command) string {
 			}
 		} else if cmd.Name == "c" {
 			msg = " "
+		} else if cmd.Name == "" && stepAutoFight() {
+			// enter steps an autof in step mode
+		} else if cmd.Name == "undo" {
+			if len(cmd.Args) >= 1 && cmd.Args[0] == "list" {
+				listUndo()
+			} else if undo() {
+				msg = " "
+			}
+		} else if cmd.Name == "redo" {
+			if redo() {
+				msg = " "
+			}
+		} else if cmd.Name == "campaign" {
+			msg = campaignCommand(cmd)
+		} else if cmd.Name == "history" {
+			historyCommand(cmd)
+		} else if cmd.Name == "save" {
+			saveCommand(cmd)
+		} else if cmd.Name == "load" {
+			msg = loadCommand(cmd)
 		} else if cmd.Name == "help" {
-			sendConsole("stat - show overall status, place and NPC health\nls [places|chars|npcs] - list all objects of a particular type\nplace PLACE - (p) change to PLACE\ndrop NAME - drop an instance of NAME into the place. This will be an NPC and NAME will be the key from the 'ls chars' list.\ncombat - enter combat rounds and roll initiative\nendcombat - ends combat rounds and removes initiative\natt NAME.ATTINDEX TARGET - attack TARGET NPC or player with by NAME and use attack type (0 - n) specified by ATTINDEX\nnt - advance to next turn in initiative ranking\npt - return to previous turn in initiative ranking\nreset - reset all state\nclearnpcs - clears out NPCS\nreload - reloads all configuration data\nsethp CHAR - sets HP of kCHAR\nsubhp CHAR - subtract HP from CHAR\naddhp CHAR - add HP to CHAR\nroll DICESTRING - (r) roll a dice string (e.g., 1d4+2) and show it on the main page\nrq - roll a dice string but only print to console\nv - view a character\nmsg - send an arbitrary message to the players\nclear - (c) clear any message or output\n")
+			sendConsole("stat - show overall status, place and NPC health\nls [places|chars|npcs] - list all objects of a particular type\nplace PLACE - (p) change to PLACE\ndrop NAME - drop an instance of NAME into the place. This will be an NPC and NAME will be the key from the 'ls chars' list.\nbuild easy|medium|hard|deadly [race=RACE] [tag=TAG] [place=PLACE] [WORD] [dry] - drop a random group of matching NPCs that fits the party's XP budget, dry only previews it\nencounter - show the difficulty of the NPCs in the place against the party\ncombat - enter combat rounds and roll initiative\nendcombat - ends combat rounds and removes initiative\natt NAME.ATTINDEX TARGET - attack TARGET NPC or player with by NAME and use attack type (0 - n) specified by ATTINDEX\nact KEY multiattack|ATTINDEX TARGET [adv|dis] - KEY takes its action to multiattack or attack TARGET\nact KEY bonus|reaction ATTINDEX TARGET [adv|dis] - attack using the bonus action or reaction\nla KEY INDEX [TARGET] [adv|dis] - spend legendary action points on legendary action INDEX\nlair KEY INDEX - take lair action INDEX on initiative count 20\nsim npcs=KEY,KEY [party=KEY,KEY] [n=RUNS] [seed=SEED] - simulate the fight RUNS times and report the odds\nautof [delay=MS] [step] - fight automatically until one side is down, in step mode taking one action each time enter is pressed\nautof pause|resume|stop - pause, carry on with or stop autof\nautof step|run|delay MS - switch autof to step mode, back to running, or change the pause between actions\nnt - advance to next turn in initiative ranking, starting a new round after the last combatant\npt - return to previous turn in initiative ranking\nreset - reset all state\nclearnpcs - clears out NPCS\nreload - reloads all configuration data\nsethp CHAR - sets HP of kCHAR\nsubhp CHAR - subtract HP from CHAR\naddhp CHAR - add HP to CHAR\nroll DICESTRING - (r) roll a dice string (e.g., 1d4+2) and show it on the main page\nrq - roll a dice string but only print to console\nv - view a character\nmsg - send an arbitrary message to the players\nclear - (c) clear any message or output\ncoins KEY [AMOUNT] - show KEY's purse or add AMOUNT (e.g. 10gp, -5sp) to it\nbuy KEY OBJ - KEY buys OBJ from the shop in the place\nsell KEY OBJ - KEY sells OBJ to the shop for half its price\ngive OBJ FROM TO - move an object between characters or NPCs\ntake OBJ|coins CHAR - CHAR picks up loot lying in the place\nloot NPC - leave a defeated NPC's inventory, and a roll on its loot table, in the place for the players to take\nrollloot [TABLE|NPC] - roll on a loot table, or the place's, and leave what it gives in the place\nvo loot - show the loot lying in the place\nequip KEY OBJ - equip a weapon, armor or shield from player KEY's inventory\nunequip KEY OBJ - take off an equipped item\nxp [KEY AMOUNT] - show the party's XP, or give AMOUNT XP to player KEY\nmilestone [on|off] - let the party advance a level, or turn milestone levelling on or off\ncampaign [switch|new NAME] - show the campaigns, switch to another or make a new one from the default campaign's assets\nhistory [session=N] [char=KEY] [type=TYPE] [n=COUNT] - show the campaign history, also at /history\nsave [NAME|list] - save the world to saves/NAME.json, the autosave with no NAME, or list the saves\nload [NAME] - load a save, the autosave with no NAME\nundo [list] - undo the last state changing command, or list what can be undone\nredo - redo the last undone command\n")
 			msg = " "
+		} else if cmd.Name == "sim" {
+			simCommand(cmd)
 		} else if cmd.Name == "autof" {
-			go autoFight()
-			msg = " "
+			msg = autoFightCommand(cmd)
 		} else if cmd.Name == "ant" {
 			autoAttack()
+		} else if cmd.Name == "act" {
+			msg = actCommand(cmd)
+		} else if cmd.Name == "la" {
+			msg = legendaryCommand(cmd)
+		} else if cmd.Name == "lair" {
+			msg = lairCommand(cmd)
 		} else if cmd.Name == "nt" {
 			nextTurn()
 			msg = " "
@@ -1556,6 +1721,8 @@ func executeCommand(cmd Command) string {
 			}
 			world.Music = pl.Music
 			msg = " "
+		} else if cmd.Name == "vo" && len(cmd.Args) >= 1 && cmd.Args[0] == "loot" {
+			msg = viewLoot()
 		} else if cmd.Name == "vo" && len(cmd.Args) >= 1 {
 			msg = viewObj(cmd.Args[0])
 		} else if cmd.Name == "cvo" && len(cmd.Args) >= 1 {
@@ -1635,20 +1802,61 @@ func executeCommand(cmd Command) string {
 		} else if cmd.Name == "clearnpcs" {
 			initNpcs()
 			msg = " "
+		} else if cmd.Name == "encounter" {
+			printEncounter()
+		} else if cmd.Name == "build" {
+			if buildCommand(cmd) {
+				msg = " "
+			}
+		} else if cmd.Name == "buy" || cmd.Name == "sell" {
+			msg = shopCommand(cmd)
+		} else if cmd.Name == "coins" {
+			msg = coinsCommand(cmd)
+		} else if cmd.Name == "give" {
+			msg = giveCommand(cmd)
+		} else if cmd.Name == "take" {
+			msg = takeCommand(cmd)
+		} else if cmd.Name == "rollloot" {
+			msg = rollLootCommand(cmd)
+		} else if cmd.Name == "loot" {
+			msg = lootCommand(cmd)
+		} else if cmd.Name == "equip" || cmd.Name == "unequip" {
+			msg = equipCommand(cmd)
+		} else if cmd.Name == "xp" {
+			if len(cmd.Args) == 0 {
+				printExp()
+			} else {
+				msg = xpCommand(cmd)
+			}
+		} else if cmd.Name == "milestone" {
+			msg = milestoneCommand(cmd)
 		} else if cmd.Name == "combat" {
+			if len(world.Npcs) > 0 {
+				printEncounter()
+			}
 			world.Initiativetxt = rollInitiatives(cmd.RawArgs)
 			world.Music = "fight_real.ogg"
 			msg = " "
 		} else if cmd.Name == "reset" {
+			stopAutoFight()
 			initialState(&world)
 			msg = " "
 		} else if cmd.Name == "endcombat" {
+			stopAutoFight()
+			msg = awardCombatExp()
+			if msg == "" {
+				msg = " "
+			}
 			world.Initiativetxt = ""
 			world.Outputar = make([]string, 0)
 			world.Battlelog = ""
 			world.Currentturn = 0
+			world.Round = 0
+			world.Turnstart = time.Time{}
+			clearActions()
+			clearLegendary()
+			clearFled()
 			world.Music = "Off"
-			msg = " "
 		} else if cmd.Name == "att" && len(cmd.Args) > 1 && strings.Contains(cmd.Args[0], ".") {
 			a := strings.Split(cmd.Args[0], ".")
 			atti, _ := strconv.Atoi(a[1])
@@ -1669,14 +1877,18 @@ func executeCommand(cmd Command) string {
 		} else if cmd.Name == "re" || cmd.Name == "reload" {
 			sendConsole(fmt.Sprintln("Reload Configuration"))
 			initPlaces()
-			initChars(true)
+			initChars(false)
 			initObjects()
+			initClasses()
+			initRaces()
+			initLootTables()
 			syncNpcs()
 			msg = " "
 		}
 
 
 
+	logCommand(cmd, msg)
 	fmt.Println(msg)
 	return msg
 }
@@ -1686,23 +1898,14 @@ func loopForDMInput() {
 	for {
 
 		input, _ := consolereader.ReadString('\n')
-		cmd := parseInput("console",input)
-		//msg := ""
 		//fmt.Println("Running command: ", cmd.Name)
 
-		msg := executeCommand(*cmd)
-
-		//sendConsole(fmt.Sprintf("> "))
-		fmt.Printf("> ")
-		if msg != "" {
-			world.Lastoutput = renderContent(msg, cmd)
-		}
-		h.broadcast <- []byte(world.Lastoutput)
+		consoleCommand(input)
 	}
 }
 
 func loadPlayerChar(playername string) Char {
-	filename := fmt.Sprintf("assets/players/%s.json",playername)
+	filename := playerFile(playername)
 	file, err := os.Open(filename)
 
 	if err != nil {
@@ -1736,7 +1939,6 @@ func updatePlayerChar(req *http.Request) {
 	//char.Abilities = req.Form["abilities"]
 	char.HP,_ = strconv.Atoi(req.Form["hp"][0])
 	char.AC,_ = strconv.Atoi(req.Form["ac"][0])
-	char.Initiative,_ = strconv.Atoi(req.Form["initiative"][0])
 	//char.Attacks,_ = req.Form["attacks"]
 	atts := make([]Attack,0)
 	json.Unmarshal([]byte(req.Form["attacks"][0]), &atts)
@@ -1749,8 +1951,6 @@ func updatePlayerChar(req *http.Request) {
 	char.Background = req.Form["background"][0]
 	char.Image = req.Form["image"][0]
 	char.Inspiration,_ = strconv.Atoi(req.Form["inspiration"][0])
-	char.ProfBonus,_ = strconv.Atoi(req.Form["profbonus"][0])
-	char.PassPerception,_ = strconv.Atoi(req.Form["passperception"][0])
 	char.HitDice = req.Form["hitdice"][0]
 	char.Speed,_ = strconv.Atoi(req.Form["speed"][0])
 	char.Skills = req.Form["skills"][0]
@@ -1777,7 +1977,14 @@ func updatePlayerChar(req *http.Request) {
 		char.InParty = false
 	}
 	char.Playername = req.Form["playername"][0]
+	keepPlayerState(&char, loadPlayerChar(char.Playername))
 
+	if overrides := req.FormValue("overrides"); overrides != "" {
+		over := make(map[string]int)
+		json.Unmarshal([]byte(overrides), &over)
+		char.Overrides = over
+	}
+	deriveStats(&char)
 
 	//fmt.Println(char)
 	charbytes,_ := json.Marshal(char)
@@ -1792,24 +1999,26 @@ func updatePlayerChar(req *http.Request) {
 
 }
 
-func updatePlayerFile(charname string, data []byte) {
-
-
+func writePlayerFile(charname string, data []byte) error {
 	if charname == "" {
-		fmt.Println("Error empty playername passed to updatePlayerFile()\n")
+		fmt.Println("Error empty playername passed to writePlayerFile()")
 	}
-	filename := fmt.Sprintf("assets/players/%s.json",charname)
+	filename := playerFile(charname)
 
-	err := ioutil.WriteFile(filename,data,0755)
+	return ioutil.WriteFile(filename,data,0755)
+}
+
+func updatePlayerFile(charname string, data []byte) {
+	err := writePlayerFile(charname, data)
 
 	if err != nil {
-		panic(fmt.Sprintf("Could not write to %s", filename, " ", err))
+		panic(fmt.Sprintf("Could not write to %s %s", charname, err))
 	}
 	initPlaces()
 	initChars(false)
 	initObjects()
 	syncNpcs()
-	world.Lastoutput = renderContent("", &Command{})
+	renderWorld("", &Command{})
 }
 
 func editPlayerChar(c http.ResponseWriter, req *http.Request) {
@@ -1820,6 +2029,7 @@ func editPlayerChar(c http.ResponseWriter, req *http.Request) {
 	if len(req.Form["update"]) != 0 {
 		// update player data
 		updatePlayerChar(req)
+		logEvent(playerEvent, "playeredit", []string{playerKey(strings.ToLower(playercookie.Value))}, fmt.Sprintf("%s edits their character.", playercookie.Value))
 		http.Redirect(c,req,"/",302)
 		//mainData := MainData{Host: req.Host, Content: "Successfully updated the char!<br><a href=\"/\">Return to main view</a><br>"}
 		//homeTempl.Execute(c, mainData)
@@ -1828,6 +2038,7 @@ func editPlayerChar(c http.ResponseWriter, req *http.Request) {
 		//mainData := MainData{Content: editPlayerForm(req)}
 		char := loadPlayerChar(strings.ToLower(playercookie.Value))
 		fmt.Println("Loaded ", char.Name)
+		deriveStats(&char)
 		char.JsonIfy()
 		editPlayerTempl.Execute(c, char)
 	}
@@ -1859,9 +2070,9 @@ func issueAttack(c http.ResponseWriter, req *http.Request) {
 		atti,_ := strconv.Atoi(req.Form["attack"][0])
 		msg := attack(char1, atti, char2, "")
 		cmd := parseInput("deriv",fmt.Sprintf("att %s.%d %s", char1.Key, atti, char2.Key))
+		logEvent(attackEvent, strings.TrimSpace(cmd.Name+" "+cmd.RawArgs), []string{char1.Key, char2.Key}, msg)
 		//cmd := Command{Name: "att", RawArgs: fmt.Sprintf("%s.%d %s", char1.Key, atti, char2.Key);
-		world.Lastoutput = renderContent(msg, cmd)
-		h.broadcast <- []byte(world.Lastoutput)
+		showWorld(msg, cmd)
 	} else if (char1.Name == "") {
 		fmt.Println("Failed to load ", req.Form["char"][0])
 	} else if (char2.Name == "") {
@@ -1899,12 +2110,17 @@ func webViewChar(c http.ResponseWriter, req *http.Request) {
 var chttp = http.NewServeMux()
 
 func initialState(world *WorldState) {
-	world.Players = strings.Split(world.Charlist,",")
-	world.Curhps = make(map[int]int)
+	world.Players = playerList(world.Charlist)
+	clearCombatants()
+	world.Loot = make(map[string][]string)
+	world.Lootcoins = make(map[string]int)
 	initPlaces()
 	initObjects()
 	initChars(true)
 	initNpcs()
+	initClasses()
+	initRaces()
+	initLootTables()
 	world.NoText = false
 	world.ShowParty = true
 	world.ShowMugs = true
@@ -1913,7 +2129,14 @@ func initialState(world *WorldState) {
 	world.Initiativetxt = ""
 	world.Outputar = make([]string, 0)
 	world.Battlelog = ""
+	world.Round = 0
+	clearActions()
+	clearLegendary()
+	clearFled()
+	initTables(world)
+}
 
+func initTables(world *WorldState) {
 	world.Abilitymods = map[int]int {
 		1: -5,
 		2: -4,
@@ -2002,9 +2225,32 @@ func initialState(world *WorldState) {
 		17: 225000,
 		18: 265000,
 		19: 305000,
+		20: 355000,
+	}
+
+	// easy, medium, hard and deadly xp thresholds per character level
+	world.Thresholdtable = map[int][]int {
+		1: {25, 50, 75, 100},
+		2: {50, 100, 150, 200},
+		3: {75, 150, 225, 400},
+		4: {125, 250, 375, 500},
+		5: {250, 500, 750, 1100},
+		6: {300, 600, 900, 1400},
+		7: {350, 750, 1100, 1700},
+		8: {450, 900, 1400, 2100},
+		9: {550, 1100, 1600, 2400},
+		10: {600, 1200, 1900, 2800},
+		11: {800, 1600, 2400, 3600},
+		12: {1000, 2000, 3000, 4500},
+		13: {1100, 2200, 3400, 5100},
+		14: {1250, 2500, 3800, 5700},
+		15: {1400, 2800, 4300, 6400},
+		16: {1600, 3200, 4800, 7200},
+		17: {2000, 3900, 5900, 8800},
+		18: {2100, 4200, 6300, 9500},
+		19: {2400, 4900, 7300, 10900},
+		20: {2800, 5700, 8500, 12700},
 	}
-
-
 }
 
 func handle_telnet(conn net.Conn) {
@@ -2016,7 +2262,7 @@ func handle_telnet(conn net.Conn) {
 	go telconn.writer()
 	defer func() { h.telunregis <- &telconn }()
 
-	magicstring := "ohgodmedusa"
+	magicstring := dmPlayername
 
 	count := 0
 	for {
@@ -2036,17 +2282,8 @@ func handle_telnet(conn net.Conn) {
 		}
 		count++
 
-		cmd := parseInput(conn.RemoteAddr().String(),line)
-		//fmt.Println(cmd)
-		msg := executeCommand(*cmd)
-
 		//h.telbroadcast <- []byte("> ")
-		telconn.send <- []byte("> ")
-
-		if msg != "" {
-			world.Lastoutput = renderContent(msg, cmd)
-		}
-		h.broadcast <- []byte(world.Lastoutput)
+		telnetCommand(&telconn, conn.RemoteAddr().String(), line)
 
 
 	}
@@ -2068,23 +2305,42 @@ func spawnTelnetService() {
 }
 
 func sendConsole(txt string) {
+	if headless {
+		return
+	}
 	txt = strings.Replace(txt,"\n","\n\r",-1)
-	fmt.Printf(txt)
+	fmt.Print(txt)
 	h.telbroadcast <- []byte(txt)
 }
 
 func main() {
 	flag.StringVar(&world.Charlist, "chars", "", "Character list separate by commas.")
+	flag.BoolVar(&world.Milestone, "milestone", false, "Level by milestone instead of XP.")
+	flag.StringVar(&world.Campaign, "campaign", "", "Campaign to run from the campaigns directory.")
 	flag.Parse()
 
+	if flag.Arg(0) == "sim" {
+		runSim(flag.Args()[1:])
+		return
+	}
+
 	homeTempl = template.Must(template.ParseFiles(filepath.Join(*assets, "home.html")))
 	editPlayerTempl = template.Must(template.ParseFiles(filepath.Join(*assets, "editplayer.html")))
 	playerIdTempl = template.Must(template.ParseFiles(filepath.Join(*assets, "playerid.html")))
+	levelUpTempl = template.Must(template.ParseFiles(filepath.Join(*assets, "levelup.html")))
+	newCharTempl = template.Must(template.ParseFiles(filepath.Join(*assets, "newchar.html")))
+
+	if world.Campaign == defaultCampaign {
+		world.Campaign = ""
+	}
+	if !campaignExists(campaignName()) {
+		log.Fatal("No campaign ", world.Campaign, " in ", campaignsDir)
+	}
 
 	//world := WorldState{}
-	initialState(&world)
+	openCampaign(*fresh)
 
-	world.Lastoutput = renderContent("", &Command{})
+	renderWorld("", &Command{})
 
 	world.Loggedin = make([]string,0)
 	go h.run()
@@ -2092,7 +2348,7 @@ func main() {
 	go spawnTelnetService()
 
 	chttp.Handle("/", http.FileServer(http.Dir(".")))
-	http.HandleFunc("/", homeHandler)
+	http.HandleFunc("/", webHandler)
 	http.HandleFunc("/ws", wsHandler)
 
 
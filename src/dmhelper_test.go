@@ -0,0 +1,33 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+// testWorld gives a test an empty world of its own, with the console
+// quiet and no history or undo. The world, those settings, simRand and the
+// working directory are put back when the test ends, so a test can change
+// any of them. Every other fixture starts with it.
+func testWorld(t *testing.T) {
+	saved := world
+	wasHeadless := headless
+	savedRand := simRand
+	wasHistoryOn := historyOn
+	undos, redos := undoHistory, redoHistory
+	dir, _ := os.Getwd()
+	t.Cleanup(func() {
+		world = saved
+		headless = wasHeadless
+		simRand = savedRand
+		historyOn = wasHistoryOn
+		undoHistory, redoHistory = undos, redos
+		os.Chdir(dir)
+	})
+
+	world = WorldState{}
+	clearCombatants()
+	headless = true
+	historyOn = false
+	undoHistory, redoHistory = nil, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var difficulties = []string{"easy", "medium", "hard", "deadly"}
+
+// XP for the fractional challenge ratings, which Challtable can't key.
+var fractionalXP = map[string]int{
+	"0":   10,
+	"1/8": 25,
+	"1/4": 50,
+	"1/2": 100,
+}
+
+// challengeXP is the XP a creature is worth, from its CR if it has one and
+// from its Level like before otherwise.
+func challengeXP(char Char) int {
+	cr := strings.TrimSpace(char.CR)
+	if cr == "" {
+		return world.Challtable[char.Level]
+	}
+
+	if xp, ok := fractionalXP[cr]; ok {
+		return xp
+	}
+
+	level, err := strconv.Atoi(cr)
+	if err != nil {
+		fmt.Println("Bad CR ", char.CR, " for ", char.Name)
+		return world.Challtable[char.Level]
+	}
+	return world.Challtable[level]
+}
+
+// encounterMultiplier scales the XP of a group of monsters for the action
+// economy, shifted a step up for small parties and down for big ones.
+func encounterMultiplier(monsters int, partysize int) float64 {
+	multipliers := []float64{0.5, 1, 1.5, 2, 2.5, 3, 4, 5}
+
+	step := 1
+	if monsters >= 15 {
+		step = 6
+	} else if monsters >= 11 {
+		step = 5
+	} else if monsters >= 7 {
+		step = 4
+	} else if monsters >= 3 {
+		step = 3
+	} else if monsters == 2 {
+		step = 2
+	}
+
+	if partysize < 3 {
+		step++
+	} else if partysize >= 6 {
+		step--
+	}
+
+	return multipliers[step]
+}
+
+// partyThresholds sums the easy/medium/hard/deadly thresholds of chars.
+func partyThresholds(chars []Char) []int {
+	thresholds := make([]int, len(difficulties))
+	for i := range chars {
+		level := chars[i].Level
+		if level < 1 {
+			level = 1
+		} else if level > 20 {
+			level = 20
+		}
+
+		for k := range thresholds {
+			thresholds[k] = thresholds[k] + world.Thresholdtable[level][k]
+		}
+	}
+	return thresholds
+}
+
+// adjustedXP is the total XP of monsters and that total after the group
+// size multiplier.
+func adjustedXP(monsters []Char, partysize int) (int, int) {
+	total := 0
+	for i := range monsters {
+		total = total + challengeXP(monsters[i])
+	}
+
+	if len(monsters) == 0 {
+		return 0, 0
+	}
+	return total, int(float64(total) * encounterMultiplier(len(monsters), partysize))
+}
+
+// rateEncounter names the hardest threshold adjusted xp reaches.
+func rateEncounter(adjusted int, thresholds []int) string {
+	rating := "trivial"
+	for i := range thresholds {
+		if adjusted >= thresholds[i] {
+			rating = difficulties[i]
+		}
+	}
+	return rating
+}
+
+func partyChars() []Char {
+	party := make([]Char, 0)
+	for i := range world.Chars {
+		if world.Chars[i].InParty && !charIsNpc(world.Chars[i].Key) {
+			party = append(party, world.Chars[i])
+		}
+	}
+	return party
+}
+
+func liveNpcs() []Char {
+	npcs := make([]Char, 0)
+	for i := range world.Npcs {
+		if world.Npcs[i].CurHP > 0 {
+			npcs = append(npcs, world.Npcs[i])
+		}
+	}
+	return npcs
+}
+
+func printEncounter() {
+	party := partyChars()
+	npcs := liveNpcs()
+	thresholds := partyThresholds(party)
+	total, adjusted := adjustedXP(npcs, len(party))
+
+	output := fmt.Sprintf("Party of %d: easy %d, medium %d, hard %d, deadly %d\n", len(party), thresholds[0], thresholds[1], thresholds[2], thresholds[3])
+	output = output + fmt.Sprintf("%d NPCs worth %d XP, adjusted %d XP (x%.1f)\n", len(npcs), total, adjusted, encounterMultiplier(len(npcs), len(party)))
+	output = output + fmt.Sprintf("Difficulty: %s\n", rateEncounter(adjusted, thresholds))
+	sendConsole(output)
+}
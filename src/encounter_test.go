@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestEncounterMultiplier(t *testing.T) {
+	tests := []struct {
+		monsters, partysize int
+		want                float64
+	}{
+		{1, 4, 1},
+		{2, 4, 1.5},
+		{4, 4, 2},
+		{8, 4, 2.5},
+		{12, 4, 3},
+		{15, 4, 4},
+		{1, 2, 1.5},
+		{15, 2, 5},
+		{1, 6, 0.5},
+		{4, 6, 1.5},
+	}
+
+	for _, tt := range tests {
+		if got := encounterMultiplier(tt.monsters, tt.partysize); got != tt.want {
+			t.Log("Expected x", tt.want, " for ", tt.monsters, " monsters vs ", tt.partysize, " but got x", got)
+			t.Fail()
+		}
+	}
+}
+
+func TestChallengeXP(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+
+	tests := []struct {
+		char Char
+		want int
+	}{
+		{Char{CR: "1/4", Level: 9}, 50},
+		{Char{CR: "0"}, 10},
+		{Char{CR: "3", Level: 1}, 700},
+		{Char{Level: 2}, 450},
+	}
+
+	for _, tt := range tests {
+		if got := challengeXP(tt.char); got != tt.want {
+			t.Log("Expected ", tt.want, " xp for CR ", tt.char.CR, " level ", tt.char.Level, " but got ", got)
+			t.Fail()
+		}
+	}
+}
+
+func TestRateEncounter(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+
+	// four level 3 characters: 300/600/900/1600
+	party := []Char{{Level: 3}, {Level: 3}, {Level: 3}, {Level: 3}}
+	thresholds := partyThresholds(party)
+	if thresholds[0] != 300 || thresholds[3] != 1600 {
+		t.Log("Expected 300 and 1600 thresholds but got ", thresholds)
+		t.Fail()
+	}
+
+	// two CR 2 ogres: 900 xp, x1.5
+	ogres := []Char{{CR: "2"}, {CR: "2"}}
+	total, adjusted := adjustedXP(ogres, len(party))
+	if total != 900 || adjusted != 1350 {
+		t.Log("Expected 900/1350 xp but got ", total, adjusted)
+		t.Fail()
+	}
+
+	if rating := rateEncounter(adjusted, thresholds); rating != "hard" {
+		t.Log("Expected hard but got ", rating)
+		t.Fail()
+	}
+
+	if rating := rateEncounter(100, thresholds); rating != "trivial" {
+		t.Log("Expected trivial but got ", rating)
+		t.Fail()
+	}
+}
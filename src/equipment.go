@@ -0,0 +1,226 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Most Dex a medium armor adds to AC unless the armor says otherwise.
+const mediumDexCap = 2
+
+func isWeapon(obj Object) bool {
+	return obj.Damage != ""
+}
+
+func isArmor(obj Object) bool {
+	return obj.ArmorAC > 0 || obj.Shield > 0
+}
+
+func hasItem(items []string, key string) bool {
+	for i := range items {
+		if items[i] == key {
+			return true
+		}
+	}
+	return false
+}
+
+func removeItem(items []string, key string) []string {
+	for i := range items {
+		if items[i] == key {
+			return append(items[:i:i], items[i+1:]...)
+		}
+	}
+	return items
+}
+
+// playerIndex is the index in world.Chars of the player character with key,
+// or -1.
+func playerIndex(key string) int {
+	for i := range world.Chars {
+		if world.Chars[i].Key == key && world.Chars[i].Playername != "" {
+			return i
+		}
+	}
+	return -1
+}
+
+// playerKey is the key of the character playername plays, or "".
+func playerKey(playername string) string {
+	for i := range world.Chars {
+		if world.Chars[i].Playername == playername && playername != "" {
+			return world.Chars[i].Key
+		}
+	}
+	return ""
+}
+
+// armorDex is how much of a Dex modifier armor lets through.
+func armorDex(obj Object, dexmod int) int {
+	limit := -1
+	if obj.Armor == "heavy" {
+		limit = 0
+	} else if obj.Armor == "medium" {
+		limit = mediumDexCap
+	}
+	if obj.DexCap > 0 {
+		limit = obj.DexCap
+	}
+
+	if limit >= 0 && dexmod > limit {
+		return limit
+	}
+	return dexmod
+}
+
+// equippedAC is the AC from the armor and shield a char has equipped, and
+// false if it has none so its own AC stands.
+func equippedAC(char Char) (int, bool) {
+	dexmod := abilityMod(char.Abilities.Dex)
+	ac := 10 + dexmod
+	armored := false
+
+	for i := range char.Equipped {
+		obj := getObject(char.Equipped[i])
+		if obj.ArmorAC > 0 {
+			ac = obj.ArmorAC + armorDex(obj, dexmod) + obj.Magic
+			armored = true
+		}
+	}
+	for i := range char.Equipped {
+		obj := getObject(char.Equipped[i])
+		if obj.Shield > 0 {
+			ac = ac + obj.Shield + obj.Magic
+			armored = true
+		}
+	}
+	return ac, armored
+}
+
+// weaponAttack is the attack an equipped weapon gives char.
+func weaponAttack(char Char, obj Object) Attack {
+	att := Attack{Name: obj.Name, Range: obj.Range, Dtype: obj.Dtype, Verb: obj.Verb, Magic: obj.Magic, Item: obj.Key}
+	att.Ability = "Str"
+	if obj.Finesse {
+		att.Ability = "finesse"
+	} else if obj.Ranged {
+		att.Ability = "Dex"
+	}
+	if att.Verb == "" {
+		att.Verb = "attacks"
+	}
+
+	bonus := abilityMod(abilityScore(char.Abilities, attackAbility(char, att))) + obj.Magic
+	att.Damageroll = obj.Damage
+	if bonus > 0 {
+		att.Damageroll = fmt.Sprintf("%s+%d", obj.Damage, bonus)
+	} else if bonus < 0 {
+		att.Damageroll = fmt.Sprintf("%s%d", obj.Damage, bonus)
+	}
+	return att
+}
+
+// deriveEquipment sets AC and the weapon attacks from what char has
+// equipped. Attacks that didn't come from an item are left alone.
+func deriveEquipment(char *Char) {
+	if ac, ok := equippedAC(*char); ok {
+		char.AC = ac
+	}
+
+	attacks := make([]Attack, 0)
+	for i := range char.Attacks {
+		if char.Attacks[i].Item == "" {
+			attacks = append(attacks, char.Attacks[i])
+		}
+	}
+	for i := range char.Equipped {
+		obj := getObject(char.Equipped[i])
+		if isWeapon(obj) {
+			attacks = append(attacks, weaponAttack(*char, obj))
+		}
+	}
+	char.Attacks = attacks
+}
+
+// equipCommand handles "equip KEY OBJ" and "unequip KEY OBJ".
+func equipCommand(cmd Command) string {
+	if len(cmd.Args) < 2 {
+		sendConsole(fmt.Sprintf("Usage: %s KEY OBJECT\n", cmd.Name))
+		return ""
+	}
+
+	i := playerIndex(cmd.Args[0])
+	if i == -1 {
+		sendConsole(fmt.Sprintln("No player character", cmd.Args[0]))
+		return ""
+	}
+	char := &world.Chars[i]
+	obj := getObject(cmd.Args[1])
+
+	if cmd.Name == "unequip" {
+		if !hasItem(char.Equipped, obj.Key) {
+			sendConsole(fmt.Sprintln(char.Name, "doesn't have", cmd.Args[1], "equipped"))
+			return ""
+		}
+		char.Equipped = removeItem(char.Equipped, obj.Key)
+
+		// back to unarmored rather than keeping the AC of the armor
+		if _, ok := equippedAC(*char); !ok && isArmor(obj) {
+			char.AC = 10 + abilityMod(char.Abilities.Dex)
+		}
+	} else {
+		if !hasItem(char.Inventory, obj.Key) {
+			sendConsole(fmt.Sprintln(char.Name, "isn't carrying", cmd.Args[1]))
+			return ""
+		}
+		if !isWeapon(obj) && !isArmor(obj) {
+			sendConsole(fmt.Sprintln(obj.Name, "isn't a weapon, armor or shield"))
+			return ""
+		}
+		if hasItem(char.Equipped, obj.Key) {
+			sendConsole(fmt.Sprintln(char.Name, "already has", obj.Name, "equipped"))
+			return ""
+		}
+
+		// one suit of armor and one shield at a time
+		for k := len(char.Equipped) - 1; k >= 0; k-- {
+			worn := getObject(char.Equipped[k])
+			if (obj.ArmorAC > 0 && worn.ArmorAC > 0) || (obj.Shield > 0 && worn.Shield > 0) {
+				sendConsole(fmt.Sprintln(char.Name, "takes off", worn.Name))
+				char.Equipped = removeItem(char.Equipped, worn.Key)
+			}
+		}
+		char.Equipped = append(char.Equipped, obj.Key)
+	}
+
+	deriveStats(char)
+	savePlayerChar(*char)
+
+	names := make([]string, 0)
+	for k := range char.Equipped {
+		names = append(names, getObject(char.Equipped[k]).Name)
+	}
+	sendConsole(fmt.Sprintf("%s: AC %d, equipped %s\n", char.Name, char.AC, strings.Join(names, ", ")))
+	return " "
+}
+
+func objStats(obj Object) string {
+	output := ""
+	if isWeapon(obj) {
+		output = output + fmt.Sprintf("<p>Damage: %s %s, range %s", obj.Damage, obj.Dtype, obj.Range)
+		if obj.Finesse {
+			output = output + ", finesse"
+		}
+		output = output + "</p>"
+	}
+	if obj.ArmorAC > 0 {
+		output = output + fmt.Sprintf("<p>AC %d, %s armor</p>", obj.ArmorAC, obj.Armor)
+	}
+	if obj.Shield > 0 {
+		output = output + fmt.Sprintf("<p>AC +%d</p>", obj.Shield)
+	}
+	if obj.Magic > 0 {
+		output = output + fmt.Sprintf("<p>+%d magic</p>", obj.Magic)
+	}
+	return output
+}
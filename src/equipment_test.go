@@ -0,0 +1,71 @@
+package main
+
+import (
+	"testing"
+)
+
+// equipWorld adds weapons and armor to a world set up with testWorld.
+func equipWorld() {
+	world.Objects = []Object{
+		{Key: "rap", Name: "rapier", Damage: "1d8", Finesse: true},
+		{Key: "lbow", Name: "longbow", Damage: "1d8", Ranged: true, Magic: 1},
+		{Key: "scale", Name: "scale mail", Armor: "medium", ArmorAC: 14},
+		{Key: "chain", Name: "chain mail", Armor: "heavy", ArmorAC: 16},
+		{Key: "shield", Name: "shield", Shield: 2},
+	}
+}
+
+func TestEquippedAC(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+	equipWorld()
+
+	char := Char{AC: 13, Abilities: Abilities{Dex: 18}}
+	if _, ok := equippedAC(char); ok {
+		t.Log("Expected no armor to leave AC alone")
+		t.Fail()
+	}
+
+	tests := []struct {
+		equipped []string
+		want     int
+	}{
+		{[]string{"scale"}, 16},
+		{[]string{"chain", "shield"}, 18},
+		{[]string{"shield"}, 16},
+	}
+
+	for _, tt := range tests {
+		char.Equipped = tt.equipped
+		if ac, _ := equippedAC(char); ac != tt.want {
+			t.Log("Expected AC ", tt.want, " with ", tt.equipped, " but got ", ac)
+			t.Fail()
+		}
+	}
+}
+
+func TestEquippedAttacks(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+	equipWorld()
+
+	char := Char{Level: 1, Abilities: Abilities{Str: 10, Dex: 16},
+		Attacks:  []Attack{{Name: "bite", Hitbonus: 4}, {Name: "old", Item: "gone"}},
+		Equipped: []string{"rap", "lbow"}}
+	deriveStats(&char)
+
+	if len(char.Attacks) != 3 || char.Attacks[0].Name != "bite" {
+		t.Log("Expected the bite and two weapon attacks but got ", char.Attacks)
+		t.FailNow()
+	}
+
+	if char.Attacks[1].Hitbonus != 5 || char.Attacks[1].Damageroll != "1d8+3" {
+		t.Log("Expected the rapier to use Dex but got ", char.Attacks[1])
+		t.Fail()
+	}
+
+	if char.Attacks[2].Hitbonus != 6 || char.Attacks[2].Damageroll != "1d8+4" {
+		t.Log("Expected the +1 longbow at +6 and 1d8+4 but got ", char.Attacks[2])
+		t.Fail()
+	}
+}
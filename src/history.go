@@ -0,0 +1,397 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Event is one change to the world in the campaign history. The history
+// is an append-only log of events, one JSON object per line.
+type Event struct {
+	Seq     int
+	Time    time.Time
+	Session int
+	Type    string
+	// keys of the characters involved
+	Chars []string `json:",omitempty"`
+	Place string
+	Cmd   string `json:",omitempty"`
+	Text  string `json:",omitempty"`
+	// the snapshot fields the event changed, or all of them when a session
+	// starts
+	Changes map[string]json.RawMessage
+}
+
+// Event types, and the commands that make them.
+const (
+	sessionEvent = "session"
+	placeEvent   = "place"
+	npcEvent     = "npc"
+	attackEvent  = "attack"
+	hpEvent      = "hp"
+	lootEvent    = "loot"
+	coinsEvent   = "coins"
+	xpEvent      = "xp"
+	combatEvent  = "combat"
+	equipEvent   = "equip"
+	playerEvent  = "player"
+	worldEvent   = "world"
+)
+
+var eventTypes = map[string]string{
+	"place":     placeEvent,
+	"p":         placeEvent,
+	"drop":      npcEvent,
+	"dropran":   npcEvent,
+	"build":     npcEvent,
+	"clearnpcs": npcEvent,
+	"att":       attackEvent,
+	"ant":       attackEvent,
+	"act":       attackEvent,
+	"la":        attackEvent,
+	"lair":      attackEvent,
+	"autof":     attackEvent,
+	"sethp":     hpEvent,
+	"subhp":     hpEvent,
+	"addhp":     hpEvent,
+	"loot":      lootEvent,
+	"rollloot":  lootEvent,
+	"give":      lootEvent,
+	"take":      lootEvent,
+	"claim":     lootEvent,
+	"buy":       coinsEvent,
+	"sell":      coinsEvent,
+	"coins":     coinsEvent,
+	"xp":        xpEvent,
+	"milestone": xpEvent,
+	"levelup":   xpEvent,
+	"combat":    combatEvent,
+	"endcombat": combatEvent,
+	"nt":        combatEvent,
+	"pt":        combatEvent,
+	"re":        combatEvent,
+	"equip":     equipEvent,
+	"unequip":   equipEvent,
+	"newchar":   playerEvent,
+}
+
+var (
+	// the log is only written once a session has started, so tests and
+	// simulations leave no history behind
+	historyOn      bool
+	historySeq     int
+	historySession int
+	// the world as of the last event, to find what the next one changed
+	historyState map[string]json.RawMessage
+)
+
+var htmlTags = regexp.MustCompile("<[^>]*>")
+
+func historyFile() string {
+	return filepath.Join(saveDir(), "history.jsonl")
+}
+
+func eventType(cmd string) string {
+	if typ, ok := eventTypes[cmd]; ok {
+		return typ
+	}
+	return worldEvent
+}
+
+// Snapshot fields that are only what the table was last shown. They change
+// with nearly every command, so the history leaves them out.
+var displayFields = []string{"Outputar", "Battlelog", "Lastbattlemsg"}
+
+// historyFields is the world as snapshot fields, less the display ones.
+func historyFields() map[string]json.RawMessage {
+	fields := make(map[string]json.RawMessage)
+	err := json.Unmarshal(takeSnapshot(), &fields)
+	if err != nil {
+		fmt.Println("Failed to read world snapshot: ", err)
+	}
+	for i := range displayFields {
+		delete(fields, displayFields[i])
+	}
+	return fields
+}
+
+// restoreFields puts the play in fields, as made by historyFields, back
+// over the world as the assets have it.
+func restoreFields(fields map[string]json.RawMessage) {
+	data, err := json.Marshal(fields)
+	if err != nil {
+		fmt.Println("Failed to rebuild world: ", err)
+		return
+	}
+	players := make([]string, 0)
+	json.Unmarshal(fields["Players"], &players)
+	world.Players = players
+	world.Charlist = strings.Join(players, ",")
+	restoreRuntime(data)
+}
+
+func readHistory() ([]Event, error) {
+	events := make([]Event, 0)
+	file, err := os.Open(historyFile())
+	if err != nil {
+		return events, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, 64*1024), 64*1024*1024)
+	for scanner.Scan() {
+		event := Event{}
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			// a line cut short by a crash
+			fmt.Println("Skipping bad history line: ", err)
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
+
+func appendEvent(event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		fmt.Println("Failed to record event: ", err)
+		return
+	}
+
+	err = os.MkdirAll(saveDir(), 0755)
+	if err == nil {
+		var file *os.File
+		file, err = os.OpenFile(historyFile(), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = file.Write(append(data, '\n'))
+			file.Close()
+		}
+	}
+	if err != nil {
+		fmt.Println("Failed to write history: ", err)
+	}
+}
+
+// logEvent records what changed in the world since the last event, if
+// anything did.
+func logEvent(typ string, cmd string, chars []string, text string) {
+	if !historyOn {
+		return
+	}
+
+	fields := historyFields()
+	changes := make(map[string]json.RawMessage)
+	for k := range fields {
+		if !bytes.Equal(fields[k], historyState[k]) {
+			changes[k] = fields[k]
+		}
+	}
+	if len(changes) == 0 {
+		return
+	}
+	historyState = fields
+
+	text = strings.TrimSpace(text)
+	if text == "" {
+		text = cmd
+	}
+	historySeq++
+	appendEvent(Event{Seq: historySeq, Time: time.Now(), Session: historySession, Type: typ, Chars: chars, Place: world.Place, Cmd: cmd, Text: text, Changes: changes})
+}
+
+// logCommand records the change a DM command made.
+func logCommand(cmd Command, msg string) {
+	if !historyOn {
+		return
+	}
+
+	chars := make([]string, 0)
+	for i := range cmd.Args {
+		key := strings.Split(cmd.Args[i], ".")[0]
+		if getNpcOrChar(key).Name != "" {
+			chars = append(chars, key)
+		}
+	}
+	logEvent(eventType(cmd.Name), strings.TrimSpace(cmd.Name+" "+cmd.RawArgs), chars, msg)
+}
+
+// rebuildFromHistory replays the history onto the world: the snapshot the
+// last session started from, then every change since. It does nothing if
+// there is no history or it belongs to a different party than -chars.
+func rebuildFromHistory() bool {
+	events, err := readHistory()
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Println("Could not read history: ", err)
+	}
+
+	start := -1
+	for i := range events {
+		if events[i].Type == sessionEvent {
+			start = i
+		}
+	}
+	if start == -1 {
+		return false
+	}
+
+	fields := make(map[string]json.RawMessage)
+	for i := start; i < len(events); i++ {
+		for k, v := range events[i].Changes {
+			fields[k] = v
+		}
+	}
+
+	players := make([]string, 0)
+	json.Unmarshal(fields["Players"], &players)
+	if world.Charlist != "" && world.Charlist != strings.Join(players, ",") {
+		fmt.Println("Not rebuilding history for party", strings.Join(players, ","), "- start with -fresh to begin a new session")
+		return false
+	}
+
+	restoreFields(fields)
+	fmt.Println("Rebuilt world from", len(events)-start, "events of session", events[start].Session)
+	return true
+}
+
+// startHistory turns on the history and starts a new session in it with
+// the whole world as it stands.
+func startHistory() {
+	events, _ := readHistory()
+	historySeq = 0
+	historySession = 0
+	if len(events) > 0 {
+		historySeq = events[len(events)-1].Seq
+		historySession = events[len(events)-1].Session
+	}
+	historySession++
+
+	historyOn = true
+	historyState = historyFields()
+	historySeq++
+	appendEvent(Event{Seq: historySeq, Time: time.Now(), Session: historySession, Type: sessionEvent, Place: world.Place, Text: fmt.Sprintf("Session %d begins.", historySession), Changes: historyState})
+}
+
+// historyFilter picks events by session, character and type. Zero values
+// match everything.
+type historyFilter struct {
+	Session int
+	Char    string
+	Type    string
+	// only the last Count events, if set
+	Count int
+}
+
+func (f historyFilter) match(event Event) bool {
+	if f.Session != 0 && event.Session != f.Session {
+		return false
+	}
+	if f.Type != "" && event.Type != f.Type {
+		return false
+	}
+	return f.Char == "" || hasItem(event.Chars, f.Char)
+}
+
+func filterHistory(events []Event, f historyFilter) []Event {
+	found := make([]Event, 0)
+	for i := range events {
+		if f.match(events[i]) {
+			found = append(found, events[i])
+		}
+	}
+	if f.Count > 0 && len(found) > f.Count {
+		found = found[len(found)-f.Count:]
+	}
+	return found
+}
+
+// parseHistoryFilter reads "session=N char=KEY type=TYPE n=COUNT" from a
+// console command.
+func parseHistoryFilter(args []string) historyFilter {
+	f := historyFilter{Count: 20}
+	for i := range args {
+		kv := strings.SplitN(args[i], "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		switch kv[0] {
+		case "session":
+			f.Session, _ = strconv.Atoi(kv[1])
+		case "char":
+			f.Char = kv[1]
+		case "type":
+			f.Type = kv[1]
+		case "n":
+			f.Count, _ = strconv.Atoi(kv[1])
+		}
+	}
+	return f
+}
+
+func eventLine(event Event) string {
+	return fmt.Sprintf("%d [s%d %s] %s: %s", event.Seq, event.Session, event.Time.Format("Jan 2 15:04"), event.Type, plainText(event))
+}
+
+// plainText is an event's text without the markup it was shown with.
+func plainText(event Event) string {
+	return strings.Join(strings.Fields(htmlTags.ReplaceAllString(event.Text, " ")), " ")
+}
+
+// historyCommand handles "history [session=N] [char=KEY] [type=TYPE] [n=COUNT]".
+func historyCommand(cmd Command) {
+	events, err := readHistory()
+	if err != nil && !os.IsNotExist(err) {
+		sendConsole(fmt.Sprintln("Could not read history:", err))
+		return
+	}
+
+	output := ""
+	events = filterHistory(events, parseHistoryFilter(cmd.Args))
+	for i := range events {
+		output = output + eventLine(events[i]) + "\n"
+	}
+	if output == "" {
+		output = "No events.\n"
+	}
+	sendConsole(output)
+}
+
+func renderHistory(events []Event, f historyFilter) string {
+	session := ""
+	if f.Session != 0 {
+		session = strconv.Itoa(f.Session)
+	}
+	output := "<div id=\"history\"><form action=\"/history\">"
+	output = output + fmt.Sprintf("Session <input name=\"session\" size=3 value=\"%s\"> ", session)
+	output = output + fmt.Sprintf("Character <input name=\"char\" size=6 value=\"%s\"> ", html.EscapeString(f.Char))
+	output = output + fmt.Sprintf("Type <input name=\"type\" size=6 value=\"%s\"> ", html.EscapeString(f.Type))
+	output = output + "<input type=\"submit\" value=\"Filter\"></form><table>"
+
+	for i := len(events) - 1; i >= 0; i-- {
+		event := events[i]
+		output = output + fmt.Sprintf("<tr><td>%d</td><td>%s</td><td>%s</td><td>%s</td><td>%s</td></tr>", event.Session, event.Time.Format("Jan 2 15:04"), html.EscapeString(event.Type), html.EscapeString(strings.Join(event.Chars, " ")), html.EscapeString(plainText(event)))
+	}
+	return output + "</table></div>"
+}
+
+// historyHandler shows the campaign history, newest first.
+func historyHandler(c http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+
+	f := historyFilter{Char: req.FormValue("char"), Type: req.FormValue("type")}
+	f.Session, _ = strconv.Atoi(req.FormValue("session"))
+	events, _ := readHistory()
+
+	mainData := MainData{Host: req.Host, Content: renderHistory(filterHistory(events, f), f)}
+	homeTempl.Execute(c, mainData)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+func historyWorld(t *testing.T) {
+	simWorld(t, 7)
+	os.Chdir(t.TempDir())
+	world.Players = []string{"bob"}
+	world.Charlist = "bob"
+}
+
+func TestHistoryRebuild(t *testing.T) {
+	historyWorld(t)
+
+	startHistory()
+	world.Place = "cave"
+	logEvent(placeEvent, "p cave", nil, "")
+	setHP("fig", 30)
+	logEvent(hpEvent, "sethp fig 30", []string{"fig"}, "")
+	// nothing changed, so nothing is logged
+	logEvent(hpEvent, "sethp fig 30", []string{"fig"}, "")
+	// nor for what was only shown
+	world.Battlelog = "Fighter misses."
+	world.Lastbattlemsg = "Fighter misses."
+	world.Outputar = append(world.Outputar, "Fighter misses.")
+	logEvent(attackEvent, "att fig.0 gob", []string{"fig", "gob"}, "Fighter misses.")
+
+	events, _ := readHistory()
+	if len(events) != 3 || events[0].Type != sessionEvent || events[2].Changes["Combatants"] == nil || events[2].Changes["Place"] != nil {
+		t.Log("Expected a session start and two changes but got ", events)
+		t.Fail()
+	}
+
+	world.Place = "void"
+	setHP("fig", 1)
+	if !rebuildFromHistory() || world.Place != "cave" || getHP("fig") != 30 {
+		t.Log("Expected the world rebuilt from history but got ", world.Place, getHP("fig"))
+		t.Fail()
+	}
+
+	world.Charlist = "alice"
+	if rebuildFromHistory() {
+		t.Log("Expected bob's history not to be rebuilt for alice")
+		t.Fail()
+	}
+}
+
+func TestHistoryFilter(t *testing.T) {
+	historyWorld(t)
+
+	startHistory()
+	setHP("fig", 20)
+	logEvent(hpEvent, "sethp fig 20", []string{"fig"}, "")
+	startHistory()
+	setHP("gob", 0)
+	logEvent(hpEvent, "sethp gob 0", []string{"gob"}, "")
+	world.Place = "cave"
+	logEvent(placeEvent, "p cave", nil, "")
+
+	events, _ := readHistory()
+	tests := []struct {
+		f    historyFilter
+		want int
+	}{
+		{historyFilter{}, 5},
+		{historyFilter{Session: 2}, 3},
+		{historyFilter{Type: hpEvent}, 2},
+		{historyFilter{Char: "fig"}, 1},
+		{historyFilter{Session: 2, Type: hpEvent}, 1},
+		{historyFilter{Count: 2}, 2},
+	}
+	for _, tt := range tests {
+		if found := filterHistory(events, tt.f); len(found) != tt.want {
+			t.Log("Expected ", tt.want, " events for ", tt.f, " but got ", len(found))
+			t.Fail()
+		}
+	}
+
+	f := parseHistoryFilter([]string{"session=2", "char=gob", "type=hp", "n=5"})
+	if f.Session != 2 || f.Char != "gob" || f.Type != "hp" || f.Count != 5 {
+		t.Log("Expected the filter read from the command but got ", f)
+		t.Fail()
+	}
+}
+
+func TestHistoryEditedAssets(t *testing.T) {
+	campaignWorld(t)
+	ioutil.WriteFile("assets/places.json", []byte(`[{"Key": "cave", "Name": "The Cave"}]`), 0644)
+	openCampaign(false)
+	world.Place = "cave"
+	logEvent(placeEvent, "p cave", nil, "")
+	bob := playerKey("bob")
+	setCharHP(bob, 4)
+	logEvent(hpEvent, "sethp "+bob+" 4", []string{bob}, "")
+
+	ioutil.WriteFile("assets/places.json", []byte(`[{"Key": "cave", "Name": "The Flooded Cave"}]`), 0644)
+	ioutil.WriteFile("assets/players/bob.json", []byte(`{"Name": "Bob", "HP": 12}`), 0644)
+	openCampaign(false)
+
+	if world.Place != "cave" || getPlace("cave").Name != "The Flooded Cave" {
+		t.Log("Expected the place from history as the assets have it now but got ", world.Place, getPlace("cave").Name)
+		t.Fail()
+	}
+	if char := getChar(bob); char.HP != 12 || getCharHP(bob) != 4 {
+		t.Log("Expected bob's edited character with the hit points from history but got ", char.HP, getCharHP(bob))
+		t.Fail()
+	}
+}
+
+func TestRenderHistoryEscapes(t *testing.T) {
+	events := []Event{{Session: 1, Type: xpEvent, Chars: []string{"bob"}, Text: "<b>Bob <script>alert(1)</script> reaches level 2!</b> <img src=x onerror=alert(2)"}}
+	output := renderHistory(events, historyFilter{})
+
+	if strings.Contains(output, "<script") || strings.Contains(output, "<img") || !strings.Contains(output, "Bob alert(1) reaches level 2! &lt;img") {
+		t.Log("Expected the event's text without its markup but got ", output)
+		t.Fail()
+	}
+}
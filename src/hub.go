@@ -10,6 +10,12 @@ type hub struct {
 	// Inbound messages from the connections.
 	broadcast chan []byte
 
+	// Updates for the connections speaking the JSON protocol.
+	jsonbroadcast chan []byte
+
+	// Messages for one connection, such as the whole view on a resync.
+	direct chan directMessage
+
 	// Inbound messages from the telnet connections.
 	telbroadcast chan []byte
 
@@ -26,8 +32,15 @@ type hub struct {
 	telunregis chan *telnetconn
 }
 
+type directMessage struct {
+	c    *connection
+	data []byte
+}
+
 var h = hub{
 	broadcast:   make(chan []byte),
+	jsonbroadcast: make(chan []byte),
+	direct:      make(chan directMessage),
 	telbroadcast:   make(chan []byte),
 	register:    make(chan *connection),
 	unregister:  make(chan *connection),
@@ -49,6 +62,21 @@ func (h *hub) run() {
 			}
 		case m := <-h.broadcast:
 			for c := range h.connections {
+				if c.json {
+					continue
+				}
+				select {
+				case c.send <- m:
+				default:
+					delete(h.connections, c)
+					close(c.send)
+				}
+			}
+		case m := <-h.jsonbroadcast:
+			for c := range h.connections {
+				if !c.json {
+					continue
+				}
 				select {
 				case c.send <- m:
 				default:
@@ -56,6 +84,15 @@ func (h *hub) run() {
 					close(c.send)
 				}
 			}
+		case m := <-h.direct:
+			if _, ok := h.connections[m.c]; ok {
+				select {
+				case m.c.send <- m.data:
+				default:
+					delete(h.connections, m.c)
+					close(m.c.send)
+				}
+			}
 		case c := <-h.telregis:
 			h.telnetconns[c] = true
 		case c := <-h.telunregis:
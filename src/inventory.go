@@ -0,0 +1,231 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+)
+
+// findHolder is the player character or NPC instance with key, or nil.
+func findHolder(key string) *Char {
+	if i := playerIndex(key); i != -1 {
+		return &world.Chars[i]
+	}
+	for i := range world.Npcs {
+		if world.Npcs[i].Key == key {
+			return &world.Npcs[i]
+		}
+	}
+	return nil
+}
+
+// saveHolder writes a player character's changed inventory to its file.
+func saveHolder(char *Char) {
+	if char.Playername != "" {
+		deriveStats(char)
+		savePlayerChar(*char)
+	}
+}
+
+// dropItem takes obj out of a char's inventory, unequipping it first.
+func dropItem(char *Char, obj string) bool {
+	if !hasItem(char.Inventory, obj) {
+		return false
+	}
+	char.Inventory = removeItem(char.Inventory, obj)
+	char.Equipped = removeItem(char.Equipped, obj)
+	return true
+}
+
+func placeLoot() []string {
+	return world.Loot[world.Place]
+}
+
+func giveCommand(cmd Command) string {
+	if len(cmd.Args) < 3 {
+		sendConsole(fmt.Sprintln("Usage: give OBJ FROM TO"))
+		return ""
+	}
+
+	from := findHolder(cmd.Args[1])
+	to := findHolder(cmd.Args[2])
+	if from == nil || to == nil {
+		sendConsole(fmt.Sprintln("No one called", cmd.Args[1], "or", cmd.Args[2]))
+		return ""
+	}
+
+	if !dropItem(from, cmd.Args[0]) {
+		sendConsole(fmt.Sprintln(from.Name, "isn't carrying", cmd.Args[0]))
+		return ""
+	}
+	to.Inventory = append(to.Inventory, cmd.Args[0])
+	saveHolder(from)
+	saveHolder(to)
+
+	return fmt.Sprintf("%s gives %s to %s.", from.Name, getObject(cmd.Args[0]).Name, to.Name)
+}
+
+// takeLoot moves obj from the place to char.
+func takeLoot(char *Char, obj string) bool {
+	loot := placeLoot()
+	if !hasItem(loot, obj) {
+		return false
+	}
+
+	world.Loot[world.Place] = removeItem(loot, obj)
+	char.Inventory = append(char.Inventory, obj)
+	saveHolder(char)
+	return true
+}
+
+func takeCommand(cmd Command) string {
+	if len(cmd.Args) < 2 {
+		sendConsole(fmt.Sprintln("Usage: take OBJ CHAR"))
+		return ""
+	}
+
+	char := findHolder(cmd.Args[1])
+	if char == nil {
+		sendConsole(fmt.Sprintln("No one called", cmd.Args[1]))
+		return ""
+	}
+
+	if cmd.Args[0] == "coins" {
+		cp := world.Lootcoins[world.Place]
+		if !takeCoins(char) {
+			sendConsole(fmt.Sprintln("There are no coins here"))
+			return ""
+		}
+		return fmt.Sprintf("%s takes %s.", char.Name, formatCoins(cp))
+	}
+
+	if !takeLoot(char, cmd.Args[0]) {
+		sendConsole(fmt.Sprintln("There is no", cmd.Args[0], "here"))
+		return ""
+	}
+	return fmt.Sprintf("%s takes %s.", char.Name, getObject(cmd.Args[0]).Name)
+}
+
+// lootCommand handles "loot NPC", leaving a defeated NPC's things and
+// whatever its loot table gives in the place for the players to claim. An NPC
+// without a table of its own rolls on the one lootTableFor picks.
+func lootCommand(cmd Command) string {
+	if len(cmd.Args) < 1 {
+		sendConsole(fmt.Sprintln("Usage: loot NPC"))
+		return ""
+	}
+
+	npc := findHolder(cmd.Args[0])
+	if npc == nil || npc.Playername != "" {
+		sendConsole(fmt.Sprintln("No NPC", cmd.Args[0]))
+		return ""
+	}
+	if npc.CurHP > 0 {
+		sendConsole(fmt.Sprintln(npc.Name, "isn't defeated yet"))
+		return ""
+	}
+	if npc.Looted {
+		sendConsole(fmt.Sprintln(npc.Name, "has already been looted"))
+		return ""
+	}
+
+	objects := npc.Inventory
+	cp := 0
+	if table, ok := lootTableFor(*npc); ok {
+		rolled, rolledcp := rollLoot(table)
+		objects = append(objects[:len(objects):len(objects)], rolled...)
+		cp = rolledcp
+	}
+	if len(objects) == 0 && cp == 0 {
+		sendConsole(fmt.Sprintln(npc.Name, "has nothing"))
+		return ""
+	}
+
+	npc.Inventory = nil
+	npc.Equipped = nil
+	npc.Looted = true
+	return fmt.Sprintf("%s had %s.", npc.Name, dropLoot(objects, cp))
+}
+
+// takeCoins gives char the coins lying in the place.
+func takeCoins(char *Char) bool {
+	cp := world.Lootcoins[world.Place]
+	if cp == 0 {
+		return false
+	}
+
+	world.Lootcoins[world.Place] = 0
+	receive(&char.Purse, cp)
+	saveHolder(char)
+	return true
+}
+
+func renderLoot() string {
+	loot := placeLoot()
+	cp := world.Lootcoins[world.Place]
+	if len(loot) == 0 && cp == 0 {
+		return ""
+	}
+
+	output := "<div id=\"loot\"><b>Loot</b><br>"
+	if cp > 0 {
+		output = output + fmt.Sprintf("%s %s<br>", formatCoins(cp), postButton("claim", "/claim", "coins", "1", "Take"))
+	}
+	for i := range loot {
+		obj := getObject(loot[i])
+		output = output + fmt.Sprintf("%s %s<br>", obj.Name, postButton("claim", "/claim", "obj", obj.Key, "Take"))
+	}
+	return output + "</div>"
+}
+
+// postButton is a one button form posting name=value to action, for
+// anything a player does that changes the world.
+func postButton(class, action, name, value, label string) string {
+	return fmt.Sprintf("<form class=\"%s\" action=\"%s\" method=\"post\"><input type=\"hidden\" name=\"%s\" value=\"%s\"/><input type=\"submit\" value=\"%s\"/></form>",
+		class, action, name, html.EscapeString(value), label)
+}
+
+// claimHandler gives a player the loot they clicked on. Only posted forms
+// take anything.
+func claimHandler(c http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+
+	playername := cookiePlayer(req)
+	if playername == "" {
+		playerIdTempl.Execute(c, nil)
+		return
+	}
+	for i := range world.Chars {
+		cp := world.Lootcoins[world.Place]
+		if world.Chars[i].Playername == playername && req.PostFormValue("coins") != "" && takeCoins(&world.Chars[i]) {
+			fmt.Println(playername, "claimed", cp, "cp")
+			msg := fmt.Sprintf("%s takes %s.", world.Chars[i].Name, formatCoins(cp))
+			logEvent(lootEvent, "claim coins", []string{world.Chars[i].Key}, msg)
+			showWorld(msg, &Command{})
+			break
+		}
+		if world.Chars[i].Playername == playername && takeLoot(&world.Chars[i], req.PostFormValue("obj")) {
+			fmt.Println(playername, "claimed", req.PostFormValue("obj"))
+			msg := fmt.Sprintf("%s takes %s.", world.Chars[i].Name, getObject(req.PostFormValue("obj")).Name)
+			logEvent(lootEvent, "claim "+req.PostFormValue("obj"), []string{world.Chars[i].Key}, msg)
+			showWorld(msg, &Command{})
+			break
+		}
+	}
+	http.Redirect(c, req, "/", 302)
+}
+
+// viewLoot shows what is lying in the place.
+func viewLoot() string {
+	output := "<div id=\"objinfo\"><p>Loot</p>"
+	if cp := world.Lootcoins[world.Place]; cp > 0 {
+		output = output + fmt.Sprintf("<p>%s</p>", formatCoins(cp))
+	}
+
+	loot := placeLoot()
+	for i := range loot {
+		obj := getObject(loot[i])
+		output = output + fmt.Sprintf("<p><b>%s</b> (%s)</p>%s%s", obj.Name, obj.Key, objStats(obj), renderContents(obj, 0))
+	}
+	return output + "</div>"
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"text/template"
+)
+
+func TestLootAndTake(t *testing.T) {
+	simWorld(t, 7)
+	equipWorld()
+	world.Loot = make(map[string][]string)
+	world.Lootcoins = make(map[string]int)
+	world.Place = "cave"
+	world.Npcs = []Char{{Name: "Goblin", Key: "gob1", CurHP: 3, Inventory: []string{"rap", "shield"}}}
+
+	if lootCommand(Command{Args: []string{"gob1"}}) != "" {
+		t.Log("Expected a live goblin not to be looted")
+		t.Fail()
+	}
+
+	world.Npcs[0].CurHP = 0
+	lootCommand(Command{Args: []string{"gob1"}})
+	if len(world.Npcs[0].Inventory) != 0 || len(world.Loot["cave"]) != 2 {
+		t.Log("Expected the goblin's things in the cave but got ", world.Loot)
+		t.Fail()
+	}
+
+	if !takeLoot(&world.Npcs[0], "rap") || takeLoot(&world.Npcs[0], "rap") {
+		t.Log("Expected the rapier to be taken only once")
+		t.Fail()
+	}
+}
+
+func TestGiveUnequips(t *testing.T) {
+	simWorld(t, 7)
+	equipWorld()
+	world.Npcs = []Char{
+		{Name: "Goblin", Key: "gob1", Inventory: []string{"rap"}, Equipped: []string{"rap"}},
+		{Name: "Goblin", Key: "gob2"},
+	}
+
+	giveCommand(Command{Args: []string{"rap", "gob1", "gob2"}})
+	if len(world.Npcs[0].Equipped) != 0 || !hasItem(world.Npcs[1].Inventory, "rap") {
+		t.Log("Expected the rapier to move to gob2 and be unequipped but got ", world.Npcs)
+		t.Fail()
+	}
+}
+
+func TestLootByCR(t *testing.T) {
+	simWorld(t, 7)
+	lootWorld()
+	world.Loot = make(map[string][]string)
+	world.Lootcoins = make(map[string]int)
+	world.Npcs = []Char{{Name: "Goblin", Key: "gob1", CR: "1/4"}}
+	simRand = rand.New(rand.NewSource(3))
+
+	lootCommand(Command{Args: []string{"gob1"}})
+	if !hasItem(world.Loot["cave"], "dag1") || world.Lootcoins["cave"] == 0 {
+		t.Log("Expected the goblin to roll on the pocket table but got ", world.Loot, world.Lootcoins)
+		t.Fail()
+	}
+
+	if lootCommand(Command{Args: []string{"gob1"}}) != "" {
+		t.Log("Expected the goblin to be looted only once")
+		t.Fail()
+	}
+}
+
+func TestDroppedNpcsOwnInventory(t *testing.T) {
+	simWorld(t, 7)
+	equipWorld()
+	world.Loot = map[string][]string{"cave": {"rap", "shield"}}
+	world.Place = "cave"
+	inventory := make([]string, 1, 4)
+	inventory[0] = "lbow"
+	world.Chars = append(world.Chars, Char{Name: "Hobgoblin", Key: "hobgoblin", HP: 11, Inventory: inventory, Equipped: []string{"lbow"}})
+	world.Npcs = nil
+
+	dropNpc("hobgoblin")
+	dropNpc("hobgoblin")
+	if len(world.Npcs) != 2 || !takeLoot(&world.Npcs[0], "rap") || !takeLoot(&world.Npcs[1], "shield") {
+		t.Log("Expected two hobgoblins to take the loot but got ", world.Npcs)
+		t.Fail()
+		return
+	}
+
+	if hasItem(world.Npcs[0].Inventory, "shield") || hasItem(world.Npcs[1].Inventory, "rap") {
+		t.Log("Expected each hobgoblin to hold only what it took but got ", world.Npcs[0].Inventory, world.Npcs[1].Inventory)
+		t.Fail()
+	}
+}
+
+func TestClaimNeedsPost(t *testing.T) {
+	playerIdTempl = template.Must(template.ParseFiles("playerid.html"))
+	playerWorld(t)
+	hubOnce.Do(func() { go h.run() })
+	equipWorld()
+	world.Loot = map[string][]string{"cave": {"rap"}}
+	world.Lootcoins = make(map[string]int)
+	world.Place = "cave"
+
+	claim := func(method string, cookie bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/claim?obj=rap", strings.NewReader(url.Values{"obj": {"rap"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie {
+			req.AddCookie(&http.Cookie{Name: "playername", Value: "bob"})
+		}
+		rec := httptest.NewRecorder()
+		claimHandler(rec, req)
+		return rec
+	}
+
+	if rec := claim("POST", false); !strings.Contains(rec.Body.String(), "playerid") || !hasItem(world.Loot["cave"], "rap") {
+		t.Log("Expected the login page and the rapier left lying but got ", rec.Body.String(), world.Loot)
+		t.Fail()
+	}
+
+	claim("GET", true)
+	if !hasItem(world.Loot["cave"], "rap") {
+		t.Log("Expected a link not to take the rapier")
+		t.Fail()
+	}
+
+	claim("POST", true)
+	if hasItem(world.Loot["cave"], "rap") || !hasItem(world.Chars[0].Inventory, "rap") {
+		t.Log("Expected bob to take the rapier but got ", world.Loot, world.Chars[0].Inventory)
+		t.Fail()
+	}
+}
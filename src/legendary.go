@@ -0,0 +1,234 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LegendaryAction is taken at the end of another creature's turn and costs
+// Cost of the creature's legendary action points. Attack names one of the
+// creature's Attacks; leave it empty for actions that are just described.
+type LegendaryAction struct {
+	Name   string
+	Cost   int
+	Attack string
+	Desc   string
+}
+
+// LairAction is taken on initiative count 20, losing initiative ties.
+type LairAction struct {
+	Name string
+	Desc string
+}
+
+func init() {
+	onCombatEvent(StartOfRound, startLairRound)
+	onCombatEvent(StartOfTurn, resetLegendary)
+	onCombatEvent(StartOfTurn, checkLair)
+	onCombatEvent(EndOfTurn, promptLegendary)
+	onCombatEvent(EndOfTurn, checkLairEndOfRound)
+}
+
+func clearLegendary() {
+	updateCombatants(func(c *Combatant) { c.Legendary = 0 })
+	for i := range world.Npcs {
+		if world.Npcs[i].Legendary > 0 {
+			setLegendary(world.Npcs[i].Key, world.Npcs[i].Legendary)
+		}
+	}
+	world.Lairdone = false
+}
+
+func setLegendary(key string, points int) {
+	c := getCombatant(key)
+	c.Legendary = points
+	setCombatant(key, c)
+}
+
+// resetLegendary restores the points of the creature (and its instances)
+// whose turn is starting.
+func resetLegendary(char Char) {
+	for i := range world.Npcs {
+		if world.Npcs[i].Name == char.Name && world.Npcs[i].Legendary > 0 {
+			setLegendary(world.Npcs[i].Key, world.Npcs[i].Legendary)
+		}
+	}
+}
+
+func promptLegendary(char Char) {
+	for i := range world.Npcs {
+		npc := world.Npcs[i]
+		if npc.Legendary == 0 || npc.Name == char.Name || npc.CurHP <= 0 {
+			continue
+		}
+
+		points := getCombatant(npc.Key).Legendary
+		if points == 0 {
+			continue
+		}
+
+		output := fmt.Sprintf("%s (%s) has %d/%d legendary action points:\n", npc.Name, npc.Key, points, npc.Legendary)
+		for k := range npc.LegendaryActions {
+			if legendaryCost(npc.LegendaryActions[k]) <= points {
+				output = output + fmt.Sprintf("  %d) %s (cost %d) %s\n", k, npc.LegendaryActions[k].Name, legendaryCost(npc.LegendaryActions[k]), npc.LegendaryActions[k].Desc)
+			}
+		}
+		output = output + fmt.Sprintf("  la %s INDEX [TARGET] to use one\n", npc.Key)
+		sendConsole(output)
+	}
+}
+
+func legendaryCost(la LegendaryAction) int {
+	if la.Cost < 1 {
+		return 1
+	}
+	return la.Cost
+}
+
+// turnInitiative returns the initiative roll of the entry at turn, as
+// rendered into world.Outputar by rollInitiatives.
+func turnInitiative(turn int) int {
+	if turn >= len(world.Outputar) {
+		return 0
+	}
+
+	entry := world.Outputar[turn]
+	start := strings.LastIndex(entry, "(")
+	end := strings.LastIndex(entry, ")")
+	if start == -1 || end < start {
+		return 0
+	}
+
+	init, _ := strconv.Atoi(entry[start+1 : end])
+	return init
+}
+
+func lairNpcs() []Char {
+	npcs := make([]Char, 0)
+	for i := range world.Npcs {
+		if len(world.Npcs[i].LairActions) > 0 && world.Npcs[i].CurHP > 0 {
+			npcs = append(npcs, world.Npcs[i])
+		}
+	}
+	return npcs
+}
+
+func startLairRound(char Char) {
+	world.Lairdone = false
+}
+
+func checkLair(char Char) {
+	if !world.Lairdone && turnInitiative(world.Currentturn) < 20 {
+		promptLair()
+	}
+}
+
+// checkLairEndOfRound catches rounds where every combatant rolled 20 or
+// more, so the lair still gets its turn.
+func checkLairEndOfRound(char Char) {
+	if !world.Lairdone && world.Currentturn == len(world.Outputar)-1 {
+		promptLair()
+	}
+}
+
+func promptLair() {
+	world.Lairdone = true
+	npcs := lairNpcs()
+	if len(npcs) == 0 {
+		return
+	}
+
+	output := "Initiative count 20, lair actions:\n"
+	for i := range npcs {
+		for k := range npcs[i].LairActions {
+			output = output + fmt.Sprintf("  %s %d) %s - %s\n", npcs[i].Key, k, npcs[i].LairActions[k].Name, npcs[i].LairActions[k].Desc)
+		}
+	}
+	output = output + "  lair KEY INDEX to use one\n"
+	sendConsole(output)
+}
+
+func renderLegendary(entry string) string {
+	output := ""
+	for i := range world.Npcs {
+		if world.Npcs[i].Legendary > 0 && world.Npcs[i].CurHP > 0 && strings.HasPrefix(entry, world.Npcs[i].Name+" (") {
+			output = output + fmt.Sprintf(" <span class=\"legendary\">[%s LA %d/%d]</span>", world.Npcs[i].Key, getCombatant(world.Npcs[i].Key).Legendary, world.Npcs[i].Legendary)
+		}
+	}
+	return output
+}
+
+// legendaryCommand handles "la KEY INDEX [TARGET] [adv|dis]".
+func legendaryCommand(cmd Command) string {
+	if len(cmd.Args) < 2 {
+		sendConsole(fmt.Sprintln("Usage: la KEY INDEX [TARGET] [adv|dis]"))
+		return ""
+	}
+
+	char1 := getNpcOrChar(cmd.Args[0])
+	idx, err := strconv.Atoi(cmd.Args[1])
+	if char1.Name == "" || err != nil || idx < 0 || idx >= len(char1.LegendaryActions) {
+		sendConsole(fmt.Sprintln("Invalid legendary action ", cmd.RawArgs))
+		return ""
+	}
+
+	la := char1.LegendaryActions[idx]
+	cost := legendaryCost(la)
+	points := getCombatant(char1.Key).Legendary
+	if cost > points {
+		sendConsole(fmt.Sprintf("%s has %d legendary action points, %s costs %d.\n", char1.Name, points, la.Name, cost))
+		return ""
+	}
+
+	if la.Attack == "" {
+		setLegendary(char1.Key, points-cost)
+		return fmt.Sprintf("%s uses %s. %s", char1.Name, la.Name, la.Desc)
+	}
+
+	atti := -1
+	for i := range char1.Attacks {
+		if char1.Attacks[i].Name == la.Attack {
+			atti = i
+		}
+	}
+	if atti == -1 {
+		sendConsole(fmt.Sprintln(char1.Name, "has no attack named", la.Attack))
+		return ""
+	}
+
+	if len(cmd.Args) < 3 {
+		sendConsole(fmt.Sprintln(la.Name, "needs a target."))
+		return ""
+	}
+	char2 := getNpcOrChar(cmd.Args[2])
+	if char2.Name == "" {
+		sendConsole(fmt.Sprintln("Failed to load ", cmd.Args[2]))
+		return ""
+	}
+	adv := ""
+	if len(cmd.Args) >= 4 {
+		adv = cmd.Args[3]
+	}
+
+	setLegendary(char1.Key, points-cost)
+	return attack(char1, atti, char2, adv)
+}
+
+// lairCommand handles "lair KEY INDEX".
+func lairCommand(cmd Command) string {
+	if len(cmd.Args) < 2 {
+		sendConsole(fmt.Sprintln("Usage: lair KEY INDEX"))
+		return ""
+	}
+
+	char1 := getNpcOrChar(cmd.Args[0])
+	idx, err := strconv.Atoi(cmd.Args[1])
+	if char1.Name == "" || err != nil || idx < 0 || idx >= len(char1.LairActions) {
+		sendConsole(fmt.Sprintln("Invalid lair action ", cmd.RawArgs))
+		return ""
+	}
+
+	world.Lairdone = true
+	return fmt.Sprintf("%s: %s", char1.LairActions[idx].Name, char1.LairActions[idx].Desc)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"testing"
+)
+
+func legendaryDragon() Char {
+	return Char{Name: "Dragon", Key: "dra", HP: 200, AC: 19, Legendary: 3,
+		Attacks: []Attack{{Name: "tail", Verb: "lashes", Hitbonus: 8, Damageroll: "2d8+6"}},
+		LegendaryActions: []LegendaryAction{
+			{Name: "Detect", Cost: 1, Desc: "It looks around."},
+			{Name: "Wing Attack", Cost: 2, Desc: "It beats its wings."},
+		}}
+}
+
+func TestLegendaryPoints(t *testing.T) {
+	simWorld(t, 7)
+	world.Chars = append(world.Chars, legendaryDragon())
+	setupSimFight([]string{"fig"}, []string{"dra"})
+	dra := world.Npcs[0]
+
+	if getCombatant(dra.Key).Legendary != 3 {
+		t.Log("Expected 3 points when combat starts but got ", getCombatant(dra.Key).Legendary)
+		t.Fail()
+	}
+
+	legendaryCommand(Command{Name: "la", Args: []string{dra.Key, "1"}})
+	if getCombatant(dra.Key).Legendary != 1 {
+		t.Log("Expected the wing attack to cost 2 points but got ", getCombatant(dra.Key).Legendary)
+		t.Fail()
+	}
+	if legendaryCommand(Command{Name: "la", Args: []string{dra.Key, "1"}}) != "" || getCombatant(dra.Key).Legendary != 1 {
+		t.Log("Expected a second wing attack to be refused with 1 point left")
+		t.Fail()
+	}
+
+	resetLegendary(dra)
+	if getCombatant(dra.Key).Legendary != 3 {
+		t.Log("Expected the points back at the start of its turn but got ", getCombatant(dra.Key).Legendary)
+		t.Fail()
+	}
+}
+
+func TestLegendaryDroppedInCombat(t *testing.T) {
+	simWorld(t, 7)
+	world.Chars = append(world.Chars, legendaryDragon())
+	setupSimFight([]string{"fig"}, []string{"gob"})
+
+	dropNpc("dra")
+	dra := world.Npcs[len(world.Npcs)-1]
+	if getCombatant(dra.Key).Legendary != 3 {
+		t.Log("Expected a dragon dropped into the fight to have its points but got ", getCombatant(dra.Key).Legendary)
+		t.Fail()
+	}
+}
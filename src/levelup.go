@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// ClassData is what a class gains as it levels, read from assets/classes.
+type ClassData struct {
+	Name      string
+	HitDie    int
+	ASILevels []int
+	// "full", "half" or "" for classes without spells
+	Casting  string
+	Features map[int]string
+}
+
+// LevelUpChoice is what the player picked in the level up form.
+type LevelUpChoice struct {
+	RollHP bool
+	// one ability twice for +2 or two different ones for +1 each
+	ASI    []string
+	Feat   string
+	Spells map[int]string
+}
+
+// LevelUpPage is the data for levelup.html.
+type LevelUpPage struct {
+	Char      Char
+	Class     ClassData
+	NewLevel  int
+	AverageHP int
+	ASI       bool
+	Features  string
+	Spells    []int
+	Error     string
+}
+
+// loadAssetDir calls load with the contents of every json file in dir.
+func loadAssetDir(dir string, load func(filename string, data []byte) error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		panic(fmt.Sprintf("Could not list %s %s", dir, err))
+	}
+
+	for i := range files {
+		file, err := os.Open(files[i])
+		if err != nil {
+			panic(fmt.Sprintf("Could not open %s", files[i]))
+		}
+
+		err = load(files[i], ReadFileContents(file))
+		file.Close()
+		if err != nil {
+			fmt.Println("Failed to read ", files[i], ": ", err)
+		}
+	}
+}
+
+func initClasses() {
+	world.Classes = make(map[string]ClassData)
+	loadAssetDir(assetPath("classes"), func(filename string, data []byte) error {
+		class := ClassData{}
+		err := json.Unmarshal(data, &class)
+		if err == nil {
+			world.Classes[strings.ToLower(class.Name)] = class
+		}
+		return err
+	})
+}
+
+func getClass(name string) (ClassData, bool) {
+	class, ok := world.Classes[strings.ToLower(strings.TrimSpace(name))]
+	return class, ok
+}
+
+func abilityMod(score int) int {
+	if mod, ok := world.Abilitymods[score]; ok {
+		return mod
+	}
+	return int(math.Floor(float64(score-10) / 2))
+}
+
+func profBonusFor(level int) int {
+	if level < 1 {
+		level = 1
+	}
+	return (level-1)/4 + 2
+}
+
+// maxSpellLevel is the highest spell level a class can cast at level.
+func maxSpellLevel(class ClassData, level int) int {
+	if class.Casting == "half" {
+		if level < 2 {
+			return 0
+		}
+		level = (level + 1) / 2
+	} else if class.Casting != "full" {
+		return 0
+	}
+
+	max := (level + 1) / 2
+	if max > 9 {
+		max = 9
+	}
+	return max
+}
+
+func isASILevel(class ClassData, level int) bool {
+	for i := range class.ASILevels {
+		if class.ASILevels[i] == level {
+			return true
+		}
+	}
+	return false
+}
+
+func averageHitDie(class ClassData) int {
+	return class.HitDie/2 + 1
+}
+
+// addAbility raises the named ability by n, up to the usual cap of 20.
+func addAbility(abil *Abilities, name string, n int) bool {
+	var score *int
+	switch strings.ToLower(name) {
+	case "str":
+		score = &abil.Str
+	case "dex":
+		score = &abil.Dex
+	case "con":
+		score = &abil.Con
+	case "int":
+		score = &abil.Int
+	case "wis":
+		score = &abil.Wis
+	case "cha":
+		score = &abil.Cha
+	default:
+		return false
+	}
+
+	*score = *score + n
+	if *score > 20 {
+		*score = 20
+	}
+	return true
+}
+
+func appendLine(text string, line string) string {
+	if text == "" {
+		return line
+	}
+	return text + "\n" + line
+}
+
+func spellField(char *Char, level int) *string {
+	fields := []*string{&char.SpellL0, &char.SpellL1, &char.SpellL2, &char.SpellL3, &char.SpellL4, &char.SpellL5, &char.SpellL6, &char.SpellL7, &char.SpellL8, &char.SpellL9}
+	if level < 0 || level >= len(fields) {
+		return nil
+	}
+	return fields[level]
+}
+
+// levelUp advances char a level in class and returns it with the HP it
+// gained.
+func levelUp(char Char, class ClassData, choice LevelUpChoice) (Char, int, error) {
+	level := char.Level + 1
+
+	if isASILevel(class, level) {
+		if choice.Feat != "" {
+			char.FeaturesTraits = appendLine(char.FeaturesTraits, fmt.Sprintf("Feat: %s", choice.Feat))
+		} else if len(choice.ASI) == 2 {
+			for i := range choice.ASI {
+				if !addAbility(&char.Abilities, choice.ASI[i], 1) {
+					return char, 0, fmt.Errorf("unknown ability %s", choice.ASI[i])
+				}
+			}
+		} else {
+			return char, 0, fmt.Errorf("level %d needs an ability score increase or a feat", level)
+		}
+	}
+
+	// con goes up before the hp is worked out so an increase counts this level
+	hp := averageHitDie(class)
+	if choice.RollHP {
+		hp = rollInt(fmt.Sprintf("1d%d", class.HitDie))
+	}
+	hp = hp + abilityMod(char.Abilities.Con)
+	if hp < 1 {
+		hp = 1
+	}
+	char.HP = char.HP + hp
+
+	num, size, _, err := parseDice(char.HitDice)
+	if err == nil && size == class.HitDie {
+		char.HitDice = fmt.Sprintf("%dd%d", num+1, size)
+	} else {
+		char.HitDice = fmt.Sprintf("%dd%d", level, class.HitDie)
+	}
+
+	if features, ok := class.Features[level]; ok {
+		char.FeaturesTraits = appendLine(char.FeaturesTraits, fmt.Sprintf("Level %d: %s", level, features))
+	}
+
+	max := maxSpellLevel(class, level)
+	for k, spells := range choice.Spells {
+		spells = strings.TrimSpace(spells)
+		field := spellField(&char, k)
+		if spells == "" || field == nil || k > max {
+			continue
+		}
+		if *field == "" {
+			*field = spells
+		} else {
+			*field = *field + ", " + spells
+		}
+	}
+
+	char.Level = level
+	deriveStats(&char)
+	return char, hp, nil
+}
+
+func levelUpPage(char Char, class ClassData) LevelUpPage {
+	level := char.Level + 1
+	page := LevelUpPage{Char: char, Class: class, NewLevel: level}
+	page.AverageHP = averageHitDie(class) + abilityMod(char.Abilities.Con)
+	page.ASI = isASILevel(class, level)
+	page.Features = class.Features[level]
+	for i := 0; i <= maxSpellLevel(class, level); i++ {
+		if class.Casting != "" {
+			page.Spells = append(page.Spells, i)
+		}
+	}
+	return page
+}
+
+func levelUpChoice(req *http.Request) LevelUpChoice {
+	choice := LevelUpChoice{Spells: make(map[int]string)}
+	choice.RollHP = req.FormValue("hp") == "roll"
+	choice.Feat = strings.TrimSpace(req.FormValue("feat"))
+	if req.FormValue("asi1") != "" && req.FormValue("asi2") != "" {
+		choice.ASI = []string{req.FormValue("asi1"), req.FormValue("asi2")}
+	}
+	for i := 0; i <= 9; i++ {
+		choice.Spells[i] = req.FormValue(fmt.Sprintf("spell%d", i))
+	}
+	return choice
+}
+
+// levelUpPlayer saves a levelled char and gives the live one its new hp.
+func levelUpPlayer(char Char, hp int) {
+	charbytes, _ := json.Marshal(char)
+	buf := bytes.NewBuffer(make([]byte, 0))
+	json.Indent(buf, charbytes, "", "  ")
+	fmt.Println(char.Name, "is now level", char.Level)
+
+	updatePlayerFile(char.Playername, buf.Bytes())
+	for i := range world.Chars {
+		if world.Chars[i].Playername == char.Playername {
+			setCharHP(world.Chars[i].Key, getCharHP(world.Chars[i].Key)+hp)
+		}
+	}
+	msg := fmt.Sprintf("<b>%s reaches level %d!</b>", char.Name, char.Level)
+	logEvent(xpEvent, "levelup", []string{playerKey(char.Playername)}, msg)
+	showWorld(msg, &Command{})
+}
+
+func levelUpHandler(c http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+
+	playername := cookiePlayer(req)
+	if playername == "" {
+		playerIdTempl.Execute(c, nil)
+		return
+	}
+	char := loadPlayerChar(playername)
+	char.Playername = playername
+
+	class, ok := getClass(char.Class)
+	if !ok {
+		fmt.Fprintf(c, "No class data for %s, ask the DM to add assets/classes/%s.json<br><a href=\"/\">Main Page</a>", template.HTMLEscapeString(char.Class), template.HTMLEscapeString(strings.ToLower(char.Class)))
+		return
+	}
+
+	if !canLevelUp(char) {
+		fmt.Fprintf(c, "%s can't level up yet.<br><a href=\"/\">Main Page</a>", template.HTMLEscapeString(char.Name))
+		return
+	}
+
+	if len(req.PostForm["levelup"]) == 0 {
+		levelUpTempl.Execute(c, levelUpPage(char, class))
+		return
+	}
+
+	levelled, hp, err := levelUp(char, class, levelUpChoice(req))
+	if err != nil {
+		page := levelUpPage(char, class)
+		page.Error = err.Error()
+		levelUpTempl.Execute(c, page)
+		return
+	}
+
+	levelUpPlayer(levelled, hp)
+	http.Redirect(c, req, "/", 302)
+}
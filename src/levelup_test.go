@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+)
+
+var testFighter = ClassData{Name: "Fighter", HitDie: 10, ASILevels: []int{4, 6}, Features: map[int]string{2: "Action Surge"}}
+
+func TestLevelUpAverage(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+
+	char := Char{Name: "Bob", Level: 1, HP: 12, HitDice: "1d10", ProfBonus: 2, Abilities: Abilities{Con: 14}}
+	char, hp, err := levelUp(char, testFighter, LevelUpChoice{})
+	if err != nil {
+		t.Log("Unexpected error ", err)
+		t.Fail()
+	}
+
+	// 6 for the average d10 and 2 for con
+	if hp != 8 || char.HP != 20 || char.Level != 2 || char.HitDice != "2d10" {
+		t.Log("Expected level 2 with 20 hp and 2d10 but got ", char.Level, char.HP, char.HitDice)
+		t.Fail()
+	}
+
+	if char.FeaturesTraits != "Level 2: Action Surge" {
+		t.Log("Expected Action Surge but got ", char.FeaturesTraits)
+		t.Fail()
+	}
+}
+
+func TestLevelUpASI(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+
+	char := Char{Name: "Bob", Level: 3, HP: 28, HitDice: "3d10", Abilities: Abilities{Con: 15, Str: 19}}
+	if _, _, err := levelUp(char, testFighter, LevelUpChoice{}); err == nil {
+		t.Log("Expected level 4 to need an ASI or feat")
+		t.Fail()
+	}
+
+	char, hp, _ := levelUp(char, testFighter, LevelUpChoice{ASI: []string{"Con", "Str"}})
+	if char.Abilities.Con != 16 || char.Abilities.Str != 20 || hp != 9 || char.ProfBonus != 2 {
+		t.Log("Expected 16 con, 20 str and 9 hp but got ", char.Abilities, hp)
+		t.Fail()
+	}
+
+	char, _, _ = levelUp(char, ClassData{HitDie: 10, ASILevels: []int{5}}, LevelUpChoice{ASI: []string{"Str", "Str"}})
+	if char.Abilities.Str != 20 || char.ProfBonus != 3 {
+		t.Log("Expected str capped at 20 and +3 proficiency but got ", char.Abilities.Str, char.ProfBonus)
+		t.Fail()
+	}
+}
+
+func TestMaxSpellLevel(t *testing.T) {
+	tests := []struct {
+		casting string
+		level   int
+		want    int
+	}{
+		{"", 10, 0},
+		{"full", 1, 1},
+		{"full", 5, 3},
+		{"full", 20, 9},
+		{"half", 1, 0},
+		{"half", 2, 1},
+		{"half", 5, 2},
+	}
+
+	for _, tt := range tests {
+		if got := maxSpellLevel(ClassData{Casting: tt.casting}, tt.level); got != tt.want {
+			t.Log("Expected spell level ", tt.want, " for ", tt.casting, " level ", tt.level, " but got ", got)
+			t.Fail()
+		}
+	}
+}
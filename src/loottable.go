@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// LootTable is a weighted list of treasure, read from assets/loot.json.
+type LootTable struct {
+	Key string
+	// used for creatures of up to this CR without a table of their own
+	MaxCR int
+	// dice and a coin, such as "3d6 sp"
+	Coins string
+	// how many times to roll on Entries, a dice string or a number
+	Rolls   string
+	Entries []LootEntry
+}
+
+// LootEntry is one line of a loot table. An entry with no Object or Table
+// is a roll that finds nothing.
+type LootEntry struct {
+	Weight int
+	Object string
+	// roll on another table instead
+	Table string
+}
+
+// Deepest a table can send rolls on to other tables.
+const maxLootDepth = 5
+
+func initLootTables() {
+	world.Loottables = make([]LootTable, 0)
+	file, err := os.Open(assetPath("loot.json"))
+
+	// loot tables are optional, NPCs then only drop what they carry
+	if os.IsNotExist(err) {
+		fmt.Println("No", assetPath("loot.json"), "so there are no loot tables")
+		return
+	}
+	if err != nil {
+		panic(fmt.Sprintf("Could not open %s", assetPath("loot.json")))
+	}
+
+	filebytes := ReadFileContents(file)
+	err = json.Unmarshal(filebytes, &world.Loottables)
+	if err != nil {
+		fmt.Println("Failed to read ", assetPath("loot.json"), ": ", err)
+		panic(err)
+	}
+}
+
+func getLootTable(key string) (LootTable, bool) {
+	for i := range world.Loottables {
+		if world.Loottables[i].Key == key {
+			return world.Loottables[i], true
+		}
+	}
+	return LootTable{}, false
+}
+
+// crLevel is a creature's CR as a whole number, fractions counting as 0.
+func crLevel(char Char) int {
+	if char.CR == "" {
+		return char.Level
+	}
+	if _, ok := fractionalXP[char.CR]; ok {
+		return 0
+	}
+	level := 0
+	fmt.Sscanf(char.CR, "%d", &level)
+	return level
+}
+
+// lootTableFor is the table for a creature: its own, the place's, or the
+// smallest one by CR that covers it.
+func lootTableFor(char Char) (LootTable, bool) {
+	if char.LootTable != "" {
+		return getLootTable(char.LootTable)
+	}
+	if table := getPlace(world.Place).LootTable; table != "" {
+		return getLootTable(table)
+	}
+
+	best := -1
+	cr := crLevel(char)
+	for i := range world.Loottables {
+		max := world.Loottables[i].MaxCR
+		if max > 0 && max >= cr && (best == -1 || max < world.Loottables[best].MaxCR) {
+			best = i
+		}
+	}
+	if best == -1 {
+		return LootTable{}, false
+	}
+	return world.Loottables[best], true
+}
+
+// rollAmount rolls a dice string, or reads a plain number as it is since the
+// dice rollers want dice.
+func rollAmount(amount string) int {
+	if n, err := strconv.Atoi(amount); err == nil {
+		return n
+	}
+	return rollInt(amount)
+}
+
+// rollCoins rolls an amount such as "3d6 sp" into copper.
+func rollCoins(coins string) int {
+	fields := strings.Fields(coins)
+	if len(fields) == 0 {
+		return 0
+	}
+
+	coin := "gp"
+	if len(fields) > 1 {
+		coin = strings.ToLower(fields[1])
+	}
+	value, ok := coinValues[coin]
+	if !ok {
+		fmt.Println("Bad coin ", coin, " in ", coins)
+		return 0
+	}
+	return rollAmount(fields[0]) * value
+}
+
+// rollLoot rolls on table and returns the objects and copper it gives.
+func rollLoot(table LootTable) ([]string, int) {
+	return rollLootDepth(table, 0)
+}
+
+func rollLootDepth(table LootTable, depth int) ([]string, int) {
+	objects := make([]string, 0)
+	cp := rollCoins(table.Coins)
+
+	total := 0
+	for i := range table.Entries {
+		total = total + table.Entries[i].Weight
+	}
+	if total <= 0 || table.Rolls == "" {
+		return objects, cp
+	}
+
+	rolls := rollAmount(table.Rolls)
+	for r := 0; r < rolls; r++ {
+		pick := rollInt(fmt.Sprintf("1d%d", total))
+		for i := range table.Entries {
+			pick = pick - table.Entries[i].Weight
+			if pick > 0 {
+				continue
+			}
+
+			entry := table.Entries[i]
+			if entry.Object != "" {
+				objects = append(objects, entry.Object)
+			} else if entry.Table != "" && depth < maxLootDepth {
+				if next, ok := getLootTable(entry.Table); ok {
+					more, morecp := rollLootDepth(next, depth+1)
+					objects = append(objects, more...)
+					cp = cp + morecp
+				}
+			}
+			break
+		}
+	}
+	return objects, cp
+}
+
+// dropLoot leaves objects and coins in the place for the players to claim.
+func dropLoot(objects []string, cp int) string {
+	world.Loot[world.Place] = append(placeLoot(), objects...)
+	world.Lootcoins[world.Place] = world.Lootcoins[world.Place] + cp
+
+	names := make([]string, 0)
+	for i := range objects {
+		names = append(names, getObject(objects[i]).Name)
+	}
+	if cp > 0 {
+		names = append(names, formatCoins(cp))
+	}
+	if len(names) == 0 {
+		return "nothing"
+	}
+	return strings.Join(names, ", ")
+}
+
+// rollLootCommand handles "rollloot [TABLE|NPC]", with no argument rolling
+// on the place's table.
+func rollLootCommand(cmd Command) string {
+	key := getPlace(world.Place).LootTable
+	if len(cmd.Args) > 0 {
+		key = cmd.Args[0]
+	}
+
+	table, ok := getLootTable(key)
+	if npc := findHolder(key); !ok && npc != nil {
+		table, ok = lootTableFor(*npc)
+	}
+	if !ok {
+		sendConsole(fmt.Sprintln("No loot table", key))
+		return ""
+	}
+
+	objects, cp := rollLoot(table)
+	found := dropLoot(objects, cp)
+	sendConsole(fmt.Sprintln("Rolled on", table.Key, ":", found))
+	return fmt.Sprintf("The party finds %s.", found)
+}
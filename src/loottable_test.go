@@ -0,0 +1,81 @@
+package main
+
+import (
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// lootWorld adds a cave and loot tables to a world set up with testWorld.
+func lootWorld() {
+	world.Places = []Place{{Key: "cave"}}
+	world.Place = "cave"
+	world.Loottables = []LootTable{
+		{Key: "pocket", MaxCR: 1, Coins: "2d6 cp", Rolls: "1", Entries: []LootEntry{{Weight: 1, Object: "dag1"}}},
+		{Key: "hoard", MaxCR: 4, Coins: "10 gp", Rolls: "3", Entries: []LootEntry{{Weight: 1, Table: "pocket"}}},
+		{Key: "empty", Rolls: "2", Entries: []LootEntry{{Weight: 5}}},
+	}
+}
+
+func TestLootTableFor(t *testing.T) {
+	testWorld(t)
+	lootWorld()
+
+	tests := []struct {
+		char Char
+		want string
+	}{
+		{Char{CR: "1/4"}, "pocket"},
+		{Char{CR: "3"}, "hoard"},
+		{Char{CR: "3", LootTable: "empty"}, "empty"},
+	}
+
+	for _, tt := range tests {
+		if table, _ := lootTableFor(tt.char); table.Key != tt.want {
+			t.Log("Expected table ", tt.want, " for CR ", tt.char.CR, " but got ", table.Key)
+			t.Fail()
+		}
+	}
+
+	if _, ok := lootTableFor(Char{CR: "10"}); ok {
+		t.Log("Expected no table for CR 10")
+		t.Fail()
+	}
+}
+
+func TestRollLoot(t *testing.T) {
+	testWorld(t)
+	lootWorld()
+	simRand = rand.New(rand.NewSource(3))
+
+	hoard, _ := getLootTable("hoard")
+	objects, cp := rollLoot(hoard)
+	if len(objects) != 3 || objects[0] != "dag1" {
+		t.Log("Expected three daggers from the pockets but got ", objects)
+		t.Fail()
+	}
+
+	// 10 gp and three rolls of 2d6 cp
+	if cp < 1006 || cp > 1036 {
+		t.Log("Expected 10 gp and some copper but got ", cp)
+		t.Fail()
+	}
+
+	empty, _ := getLootTable("empty")
+	if objects, cp := rollLoot(empty); len(objects) != 0 || cp != 0 {
+		t.Log("Expected nothing from the empty table but got ", objects, cp)
+		t.Fail()
+	}
+}
+
+func TestMissingLootTables(t *testing.T) {
+	testWorld(t)
+	lootWorld()
+	os.Chdir(t.TempDir())
+
+	initLootTables()
+	if len(world.Loottables) != 0 {
+		t.Log("Expected no loot tables without loot.json but got ", world.Loottables)
+		t.Fail()
+	}
+}
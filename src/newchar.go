@@ -0,0 +1,328 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RaceData is a playable race, read from assets/races.
+type RaceData struct {
+	Name  string
+	Speed int
+	// bonuses added to the generated scores
+	Abilities Abilities
+}
+
+// NewCharPage is the data for newchar.html.
+type NewCharPage struct {
+	Step       string
+	Name       string
+	Playername string
+	Race       string
+	Class      string
+	Method     string
+	Races      []string
+	Classes    []string
+	Abilities  []string
+	Scores     []int
+	Budget     int
+	Error      string
+}
+
+var standardArray = []int{15, 14, 13, 12, 10, 8}
+
+const pointBuyBudget = 27
+
+// What each score costs in point buy, which only allows 8 to 15.
+var pointBuyCosts = map[int]int{8: 0, 9: 1, 10: 2, 11: 3, 12: 4, 13: 5, 14: 7, 15: 9}
+
+var abilityNames = []string{"Str", "Dex", "Con", "Int", "Wis", "Cha"}
+
+var validPlayername = regexp.MustCompile("^[a-z0-9]+$")
+
+// Rolled scores waiting for a new player to assign them, so a reload of the
+// form can't roll again. Player names are in the order they rolled, and only
+// the last maxPendingRolls are kept.
+var (
+	pendingRolls = make(map[string][]int)
+	pendingOrder []string
+)
+
+const maxPendingRolls = 100
+
+// holdRolls is playername's rolled scores, rolling them the first time.
+func holdRolls(playername string) []int {
+	if rolls, ok := pendingRolls[playername]; ok {
+		return rolls
+	}
+	if len(pendingOrder) >= maxPendingRolls {
+		delete(pendingRolls, pendingOrder[0])
+		pendingOrder = pendingOrder[1:]
+	}
+	pendingRolls[playername] = rollAbilityScores()
+	pendingOrder = append(pendingOrder, playername)
+	return pendingRolls[playername]
+}
+
+// forgetRolls drops playername's rolled scores once they have been used.
+func forgetRolls(playername string) {
+	delete(pendingRolls, playername)
+	for i := range pendingOrder {
+		if pendingOrder[i] == playername {
+			pendingOrder = append(pendingOrder[:i], pendingOrder[i+1:]...)
+			break
+		}
+	}
+}
+
+func initRaces() {
+	world.Races = make(map[string]RaceData)
+	loadAssetDir(assetPath("races"), func(filename string, data []byte) error {
+		race := RaceData{}
+		err := json.Unmarshal(data, &race)
+		if err == nil {
+			world.Races[strings.ToLower(race.Name)] = race
+		}
+		return err
+	})
+}
+
+func getRace(name string) (RaceData, bool) {
+	race, ok := world.Races[strings.ToLower(strings.TrimSpace(name))]
+	return race, ok
+}
+
+// rollAbilityScore rolls 4d6 and drops the lowest.
+func rollAbilityScore() int {
+	dice := make([]int, 4)
+	for i := range dice {
+		dice[i] = rollInt("1d6")
+	}
+	sort.Ints(dice)
+	return dice[1] + dice[2] + dice[3]
+}
+
+func rollAbilityScores() []int {
+	scores := make([]int, len(abilityNames))
+	for i := range scores {
+		scores[i] = rollAbilityScore()
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(scores)))
+	return scores
+}
+
+func pointBuyCost(scores []int) (int, error) {
+	total := 0
+	for i := range scores {
+		cost, ok := pointBuyCosts[scores[i]]
+		if !ok {
+			return 0, fmt.Errorf("point buy scores must be from 8 to 15, not %d", scores[i])
+		}
+		total = total + cost
+	}
+	return total, nil
+}
+
+// sameScores reports whether scores uses each of pool exactly once.
+func sameScores(scores []int, pool []int) bool {
+	if len(scores) != len(pool) {
+		return false
+	}
+
+	a := append([]int{}, scores...)
+	b := append([]int{}, pool...)
+	sort.Ints(a)
+	sort.Ints(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// checkScores validates the scores a player assigned for method.
+func checkScores(method string, playername string, scores []int) error {
+	if method == "pointbuy" {
+		cost, err := pointBuyCost(scores)
+		if err != nil {
+			return err
+		}
+		if cost > pointBuyBudget {
+			return fmt.Errorf("those scores cost %d points, only %d can be spent", cost, pointBuyBudget)
+		}
+	} else if method == "array" {
+		if !sameScores(scores, standardArray) {
+			return fmt.Errorf("use each of %v once", standardArray)
+		}
+	} else if method == "roll" {
+		rolls, ok := pendingRolls[playername]
+		if !ok {
+			return fmt.Errorf("no rolls for %s, start again", playername)
+		}
+		if !sameScores(scores, rolls) {
+			return fmt.Errorf("use each of %v once", rolls)
+		}
+	} else {
+		return fmt.Errorf("unknown method %s", method)
+	}
+	return nil
+}
+
+func abilitiesFrom(scores []int) Abilities {
+	return Abilities{Str: scores[0], Dex: scores[1], Con: scores[2], Int: scores[3], Wis: scores[4], Cha: scores[5]}
+}
+
+func addAbilities(a Abilities, b Abilities) Abilities {
+	return Abilities{Str: a.Str + b.Str, Dex: a.Dex + b.Dex, Con: a.Con + b.Con, Int: a.Int + b.Int, Wis: a.Wis + b.Wis, Cha: a.Cha + b.Cha}
+}
+
+// newChar makes a level 1 character with its stats worked out from its
+// abilities, race and class.
+func newChar(name string, playername string, race RaceData, class ClassData, scores Abilities) Char {
+	char := Char{Name: name, Playername: playername, Race: race.Name, Class: class.Name, Level: 1, InParty: true}
+	char.Abilities = addAbilities(scores, race.Abilities)
+	char.Speed = race.Speed
+
+	char.HP = class.HitDie + abilityMod(char.Abilities.Con)
+	if char.HP < 1 {
+		char.HP = 1
+	}
+	char.HitDice = fmt.Sprintf("1d%d", class.HitDie)
+	char.AC = 10 + abilityMod(char.Abilities.Dex)
+	if features, ok := class.Features[1]; ok {
+		char.FeaturesTraits = fmt.Sprintf("Level 1: %s", features)
+	}
+	char.Attacks = make([]Attack, 0)
+	char.Inventory = make([]string, 0)
+	deriveStats(&char)
+	return char
+}
+
+func checkNewPlayer(name string, playername string) error {
+	if len(strings.TrimSpace(name)) < 3 {
+		return fmt.Errorf("character names need at least 3 letters")
+	}
+	if !validPlayername.MatchString(playername) {
+		return fmt.Errorf("player names are lower case letters and numbers only")
+	}
+	if playername == dmPlayername {
+		return fmt.Errorf("%s is the DM", playername)
+	}
+	for i := range world.Players {
+		if world.Players[i] == playername {
+			return fmt.Errorf("%s is already playing", playername)
+		}
+	}
+	if _, err := os.Stat(playerFile(playername)); err == nil {
+		return fmt.Errorf("there is already a character for %s", playername)
+	}
+	return nil
+}
+
+// addPlayer writes a new player's file and adds them to the game.
+func addPlayer(char Char) error {
+	charbytes, _ := json.Marshal(char)
+	buf := bytes.NewBuffer(make([]byte, 0))
+	json.Indent(buf, charbytes, "", "  ")
+
+	err := writePlayerFile(char.Playername, buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	world.Players = append(world.Players, char.Playername)
+	world.Charlist = strings.Join(world.Players, ",")
+
+	// the new char isn't tracked yet so it starts on full hp
+	initChars(false)
+	syncNpcs()
+
+	sendConsole(fmt.Sprintln(char.Name, "joins the game as", char.Playername))
+	msg := fmt.Sprintf("<b>%s joins the party!</b>", char.Name)
+	logEvent(playerEvent, "newchar", []string{playerKey(char.Playername)}, msg)
+	showWorld(msg, &Command{})
+	return nil
+}
+
+func newCharPage(req *http.Request) NewCharPage {
+	page := NewCharPage{Abilities: abilityNames, Budget: pointBuyBudget}
+	page.Name = strings.TrimSpace(req.FormValue("charname"))
+	page.Playername = strings.ToLower(strings.TrimSpace(req.FormValue("playername")))
+	page.Race = req.FormValue("race")
+	page.Class = req.FormValue("class")
+	page.Method = req.FormValue("method")
+
+	for k := range world.Races {
+		page.Races = append(page.Races, world.Races[k].Name)
+	}
+	for k := range world.Classes {
+		page.Classes = append(page.Classes, world.Classes[k].Name)
+	}
+	sort.Strings(page.Races)
+	sort.Strings(page.Classes)
+	return page
+}
+
+func newCharHandler(c http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+	page := newCharPage(req)
+
+	if len(req.Form["assign"]) == 0 && len(req.Form["create"]) == 0 {
+		newCharTempl.Execute(c, page)
+		return
+	}
+
+	race, rok := getRace(page.Race)
+	class, cok := getClass(page.Class)
+	err := checkNewPlayer(page.Name, page.Playername)
+	if err == nil && (!rok || !cok) {
+		err = fmt.Errorf("pick a race and a class")
+	}
+	if err != nil {
+		page.Error = err.Error()
+		newCharTempl.Execute(c, page)
+		return
+	}
+
+	page.Step = "assign"
+	if page.Method == "roll" {
+		page.Scores = holdRolls(page.Playername)
+	} else if page.Method == "array" {
+		page.Scores = standardArray
+	} else {
+		page.Method = "pointbuy"
+	}
+
+	if len(req.Form["create"]) == 0 {
+		newCharTempl.Execute(c, page)
+		return
+	}
+
+	scores := make([]int, len(abilityNames))
+	for i := range abilityNames {
+		scores[i], _ = strconv.Atoi(req.FormValue(abilityNames[i]))
+	}
+	err = checkScores(page.Method, page.Playername, scores)
+	if err == nil {
+		// the rolls are spent, even if the character can't be added
+		forgetRolls(page.Playername)
+		err = addPlayer(newChar(page.Name, page.Playername, race, class, abilitiesFrom(scores)))
+	}
+	if err != nil {
+		page.Error = err.Error()
+		newCharTempl.Execute(c, page)
+		return
+	}
+
+	fmt.Println(page.Playername, "created", page.Name)
+	http.SetCookie(c, &http.Cookie{Name: "playername", Value: page.Playername})
+	http.Redirect(c, req, "/", 302)
+}
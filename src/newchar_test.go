@@ -0,0 +1,105 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+)
+
+func TestPointBuy(t *testing.T) {
+	if cost, _ := pointBuyCost([]int{15, 15, 15, 8, 8, 8}); cost != 27 {
+		t.Log("Expected 27 points but got ", cost)
+		t.Fail()
+	}
+
+	if checkScores("pointbuy", "bob", []int{15, 15, 15, 9, 8, 8}) == nil {
+		t.Log("Expected 28 points to be too many")
+		t.Fail()
+	}
+
+	if checkScores("pointbuy", "bob", []int{16, 8, 8, 8, 8, 8}) == nil {
+		t.Log("Expected 16 to be out of range for point buy")
+		t.Fail()
+	}
+}
+
+func TestStandardArray(t *testing.T) {
+	if err := checkScores("array", "bob", []int{8, 10, 12, 13, 14, 15}); err != nil {
+		t.Log("Expected the standard array in any order to be fine but got ", err)
+		t.Fail()
+	}
+
+	if checkScores("array", "bob", []int{15, 15, 13, 12, 10, 8}) == nil {
+		t.Log("Expected a repeated 15 to be rejected")
+		t.Fail()
+	}
+}
+
+func TestRollAbilityScores(t *testing.T) {
+	testWorld(t)
+	simRand = rand.New(rand.NewSource(7))
+
+	for i := 0; i < 100; i++ {
+		if score := rollAbilityScore(); score < 3 || score > 18 {
+			t.Log("Expected 4d6 drop lowest to be 3 to 18 but got ", score)
+			t.Fail()
+		}
+	}
+}
+
+func TestNewChar(t *testing.T) {
+	testWorld(t)
+	initTables(&world)
+
+	dwarf := RaceData{Name: "Dwarf", Speed: 25, Abilities: Abilities{Con: 2}}
+	char := newChar("Thorin", "tho", dwarf, testFighter, abilitiesFrom([]int{15, 14, 13, 12, 10, 8}))
+
+	if char.Abilities.Con != 15 || char.HP != 12 || char.HitDice != "1d10" || char.Speed != 25 {
+		t.Log("Expected 15 con, 12 hp, 1d10 and speed 25 but got ", char.Abilities.Con, char.HP, char.HitDice, char.Speed)
+		t.Fail()
+	}
+
+	if char.Initiative != 2 || char.ProfBonus != 2 || char.PassPerception != 10 || char.AC != 12 {
+		t.Log("Expected +2 initiative, +2 proficiency, 10 passive perception and 12 AC but got ", char.Initiative, char.ProfBonus, char.PassPerception, char.AC)
+		t.Fail()
+	}
+}
+
+func TestCheckNewPlayer(t *testing.T) {
+	testWorld(t)
+	world.Players = []string{"bob"}
+
+	if err := checkNewPlayer("Thorin", dmPlayername); err == nil {
+		t.Log("Expected the DM's name to be refused")
+		t.Fail()
+	}
+	if err := checkNewPlayer("Thorin", "bob"); err == nil {
+		t.Log("Expected a player already playing to be refused")
+		t.Fail()
+	}
+}
+
+func TestPendingRolls(t *testing.T) {
+	pendingRolls = make(map[string][]int)
+	pendingOrder = nil
+
+	rolls := holdRolls("bob")
+	if again := holdRolls("bob"); !sameScores(again, rolls) {
+		t.Log("Expected bob's rolls to be kept but got ", rolls, again)
+		t.Fail()
+	}
+
+	for i := 0; i < maxPendingRolls; i++ {
+		holdRolls(fmt.Sprintf("player%d", i))
+	}
+	if _, ok := pendingRolls["bob"]; ok || len(pendingRolls) != maxPendingRolls {
+		t.Log("Expected the oldest rolls to make way but got ", len(pendingRolls))
+		t.Fail()
+	}
+
+	forgetRolls("player5")
+	if _, ok := pendingRolls["player5"]; ok || len(pendingOrder) != maxPendingRolls-1 {
+		t.Log("Expected player5's rolls to be forgotten")
+		t.Fail()
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Everything that reads or changes the world runs as a job on the
+// processor goroutine, one at a time, so the console, telnet connections,
+// web handlers and autof never race on it.
+var (
+	jobs          = make(chan func())
+	processorOnce sync.Once
+)
+
+func processJobs() {
+	for job := range jobs {
+		job()
+	}
+}
+
+// doWork runs fn on the processor and waits for it. A panic in fn is
+// passed back to the caller so, as before, it takes down only a web
+// request and not the processor. Jobs must not call doWork themselves.
+func doWork(fn func()) {
+	processorOnce.Do(func() { go processJobs() })
+
+	var failed interface{}
+	done := make(chan bool)
+	jobs <- func() {
+		defer func() {
+			failed = recover()
+			close(done)
+		}()
+		fn()
+	}
+	<-done
+
+	if failed != nil {
+		panic(failed)
+	}
+}
+
+// consoleCommand runs a line typed at the DM console and shows the result.
+func consoleCommand(input string) {
+	doWork(func() {
+		cmd := parseInput("console", input)
+		msg := executeCommand(*cmd)
+
+		fmt.Printf("> ")
+		if msg != "" {
+			renderWorld(msg, cmd)
+		}
+		broadcastWorld()
+	})
+}
+
+// telnetCommand runs a line from a telnet connection and shows the result.
+func telnetCommand(telconn *telnetconn, origin string, line string) {
+	doWork(func() {
+		cmd := parseInput(origin, line)
+		msg := executeCommand(*cmd)
+
+		telconn.send <- []byte("> ")
+		if msg != "" {
+			renderWorld(msg, cmd)
+		}
+		broadcastWorld()
+	})
+}
+
+// webHandler runs homeHandler on the processor. Asset files are served
+// straight away since they don't touch the world and a big image going to
+// a slow tablet would hold everybody up. For the same reason the page is
+// only built on the processor and sent once the job is done.
+func webHandler(c http.ResponseWriter, req *http.Request) {
+	if strings.Contains(req.URL.Path, "assets") {
+		if cv, _ := req.Cookie("playername"); cv != nil && cv.Value != "" {
+			chttp.ServeHTTP(c, req)
+			return
+		}
+	}
+	page := &pageWriter{header: make(http.Header)}
+	doWork(func() { homeHandler(page, req) })
+	page.send(c)
+}
+
+// pageWriter holds a response built on the processor until it is sent.
+type pageWriter struct {
+	header http.Header
+	code   int
+	body   bytes.Buffer
+}
+
+func (p *pageWriter) Header() http.Header {
+	return p.header
+}
+
+func (p *pageWriter) WriteHeader(code int) {
+	if p.code == 0 {
+		p.code = code
+	}
+}
+
+func (p *pageWriter) Write(data []byte) (int, error) {
+	p.WriteHeader(http.StatusOK)
+	return p.body.Write(data)
+}
+
+// send writes the response to the client.
+func (p *pageWriter) send(c http.ResponseWriter) {
+	for k, v := range p.header {
+		c.Header()[k] = v
+	}
+	if p.code == 0 {
+		p.code = http.StatusOK
+	}
+	c.WriteHeader(p.code)
+	c.Write(p.body.Bytes())
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"text/template"
+	"time"
+)
+
+var hubOnce sync.Once
+
+// Run with -race: the console, telnet, web and autof all work on the world
+// at once and every change has to land.
+func TestConcurrentCommands(t *testing.T) {
+	homeTempl = template.Must(template.ParseFiles("home.html"))
+	testWorld(t)
+	os.Chdir(t.TempDir())
+	hubOnce.Do(func() { go h.run() })
+
+	doWork(func() {
+		simWorld(t, 30)
+		world.Places = []Place{{Key: "void", Name: "The Void"}}
+		world.Place = "void"
+		world.Players = []string{"bob"}
+		world.Chars = append(world.Chars, Char{Name: "Cleric", Key: "cle", HP: 20})
+		setCharHP("cle", 20)
+		world.Loot = make(map[string][]string)
+		world.Lootcoins = make(map[string]int)
+		setupSimFight([]string{"fig"}, []string{"gob"})
+	})
+
+	telconn := &telnetconn{send: make(chan []byte, 256)}
+	go func() {
+		for range telconn.send {
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			consoleCommand("subhp cle 1\n")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			telnetCommand(telconn, "test", "addhp cle 1")
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.AddCookie(&http.Cookie{Name: "playername", Value: "bob"})
+			rec := httptest.NewRecorder()
+			webHandler(rec, req)
+			if rec.Code != 200 {
+				t.Log("Expected the page but got ", rec.Code)
+				t.Fail()
+			}
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		job := newAutoFightJob(0, false)
+		runAutoFight(doWork, job.wait, job.isStopped)
+	}()
+	wg.Wait()
+	close(telconn.send)
+
+	hp := 0
+	doWork(func() { hp = getHP("cle") })
+	if hp != 20 {
+		t.Log("Expected every hp change to land but the cleric has ", hp)
+		t.Fail()
+	}
+}
+
+func TestDoWorkPanic(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Log("Expected the job's panic back")
+			t.Fail()
+		}
+	}()
+	doWork(func() { panic("boom") })
+}
+
+func TestDoWorkAfterPanic(t *testing.T) {
+	ran := false
+	doWork(func() { ran = true })
+	if !ran {
+		t.Log("Expected the processor to keep going after a panic")
+		t.Fail()
+	}
+}
+
+// slowClient takes its time reading a page.
+type slowClient struct {
+	*httptest.ResponseRecorder
+	writing chan bool
+	release chan bool
+}
+
+func (c *slowClient) Write(data []byte) (int, error) {
+	c.writing <- true
+	<-c.release
+	return c.ResponseRecorder.Write(data)
+}
+
+func TestSlowWebClient(t *testing.T) {
+	homeTempl = template.Must(template.ParseFiles("home.html"))
+	testWorld(t)
+	os.Chdir(t.TempDir())
+
+	doWork(func() {
+		simWorld(t, 7)
+		world.Players = []string{"bob"}
+	})
+
+	client := &slowClient{ResponseRecorder: httptest.NewRecorder(), writing: make(chan bool), release: make(chan bool)}
+	done := make(chan bool)
+	go func() {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "playername", Value: "bob"})
+		webHandler(client, req)
+		done <- true
+	}()
+	<-client.writing
+
+	ran := make(chan bool)
+	go doWork(func() { ran <- true })
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Log("Expected the processor to go on while the page is sent")
+		t.Fail()
+	}
+
+	close(client.release)
+	<-done
+	if client.Code != 200 || !strings.Contains(client.Body.String(), "mainpage") {
+		t.Log("Expected the page but got ", client.Code, client.Body.String())
+		t.Fail()
+	}
+}
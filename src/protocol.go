@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// The JSON protocol spoken over /ws?proto=json. Every update carries the
+// protocol version, and a client that doesn't know it falls back to the
+// HTML page. Bump it whenever a message changes in a way old clients
+// can't read.
+const protocolVersion = 3
+
+// Update is one frame sent to JSON clients. A client is sent the whole
+// view when it connects and after that only the messages that changed.
+// Updates are numbered so a client can tell when it missed one, and then
+// it asks for the whole view again.
+type Update struct {
+	Version  int
+	Seq      int
+	Full     bool
+	Messages []Message
+}
+
+// Message is one part of the table's view. Data holds the view for the
+// type, or null when there is nothing of that part to show.
+//
+// Party and npcs are lists of members with keys. When one changes only the
+// members that did are sent, and Keys has the keys of the whole list in
+// order. Without Keys, Data is the whole list.
+type Message struct {
+	Type string
+	Data interface{}
+	Keys []string `json:",omitempty"`
+}
+
+// clientRequest is what a JSON client sends: "resync" for the whole view.
+type clientRequest struct {
+	Type string
+}
+
+const resyncRequest = "resync"
+
+// Message types.
+const (
+	sceneMessage      = "scene"
+	partyMessage      = "party"
+	npcsMessage       = "npcs"
+	initiativeMessage = "initiative"
+	battleMessage     = "battle"
+	textMessage       = "message"
+	musicMessage      = "music"
+)
+
+// Message types in the order they are sent.
+var messageTypes = []string{sceneMessage, partyMessage, npcsMessage, initiativeMessage, battleMessage, textMessage, musicMessage}
+
+// Message types that are lists of members with keys.
+var listMessages = map[string]bool{partyMessage: true, npcsMessage: true}
+
+// Message types that are something happening rather than state. They are
+// sent whenever a command makes one, even if it reads the same as the last.
+var eventMessages = map[string]bool{battleMessage: true, textMessage: true}
+
+// SceneView is the place the party is in and what lies about in it.
+type SceneView struct {
+	Key   string
+	Name  string
+	Desc  string
+	Image string
+	// only the picture is shown
+	NoText bool
+	// show pictures of the party and NPCs rather than just their names
+	Mugs  bool
+	Coins string
+	Loot  []LootView
+	Shop  bool
+}
+
+type LootView struct {
+	Key  string
+	Name string
+}
+
+// PartyView is a player character as the table sees it.
+type PartyView struct {
+	Key         string
+	Name        string
+	Playername  string
+	Race        string
+	Class       string
+	Level       int
+	Image       string
+	HP          int
+	MaxHP       int
+	LevelUp     bool
+	Encumbrance string
+}
+
+// NpcView is an NPC as the table sees it. Players only get to see how
+// wounded it looks, never its hit points.
+type NpcView struct {
+	Key     string
+	Name    string
+	Race    string
+	Image   string
+	Wounded string
+}
+
+// InitiativeView is the initiative order. The client counts the time the
+// current turn has taken from Turnstart itself.
+type InitiativeView struct {
+	Round     int
+	Turnstart time.Time
+	Entries   []InitiativeEntry
+}
+
+type InitiativeEntry struct {
+	Text    string
+	Current bool
+	// legendary actions left, such as "[drag LA 2/3]"
+	Legendary string
+}
+
+// BattleView is an attack for the table to show, attacker and target
+// given by key.
+type BattleView struct {
+	Attacker string
+	Target   string
+	Text     string
+}
+
+// MessageView is the text the DM last put up. Kind is "modal" for msg,
+// "view" for looking at an object or the battle log, and "" otherwise.
+type MessageView struct {
+	Text string
+	Kind string
+}
+
+type MusicView struct {
+	Track string
+}
+
+// Only touched by processor jobs.
+var (
+	updateSeq int
+	// the view as last sent, by message type
+	viewState map[string]json.RawMessage
+	// patches renderWorld made, for broadcastWorld to send
+	pendingUpdates [][]byte
+)
+
+// woundedColor is how hurt an NPC looks.
+func woundedColor(char Char) string {
+	perc := float32(char.CurHP) / float32(char.HP)
+	if perc == 1.0 {
+		return ""
+	} else if perc > 0.80 {
+		return "green"
+	} else if perc > 0.30 {
+		return "yellow"
+	} else if perc < 0.30 {
+		return "red"
+	}
+	return ""
+}
+
+func sceneView() SceneView {
+	cplace := getPlace(world.Place)
+	scene := SceneView{Key: world.Place, Name: cplace.Name, Desc: cplace.Desc, Image: cplace.Image, NoText: world.NoText, Mugs: world.ShowMugs, Shop: len(shopStock()) > 0}
+	if cp := world.Lootcoins[world.Place]; cp > 0 {
+		scene.Coins = formatCoins(cp)
+	}
+	loot := placeLoot()
+	for i := range loot {
+		obj := getObject(loot[i])
+		scene.Loot = append(scene.Loot, LootView{Key: obj.Key, Name: obj.Name})
+	}
+	return scene
+}
+
+func partyView() []PartyView {
+	party := make([]PartyView, 0)
+	if !world.ShowParty {
+		return party
+	}
+	for _, char := range world.Chars {
+		if !char.InParty {
+			continue
+		}
+		curhp := getCharHP(char.Key)
+		if curhp < 0 {
+			char.Image = "/assets/skull.jpg"
+		}
+		party = append(party, PartyView{Key: char.Key, Name: char.Name, Playername: char.Playername, Race: char.Race, Class: char.Class, Level: char.Level, Image: char.Image, HP: curhp, MaxHP: char.HP, LevelUp: canLevelUp(char), Encumbrance: encumbranceTxt(char)})
+	}
+	return party
+}
+
+func npcsView() []NpcView {
+	npcs := make([]NpcView, 0)
+	if !world.ShowNpcs {
+		return npcs
+	}
+	for _, char := range world.Npcs {
+		if char.CurHP <= 0 {
+			char.Image = "/assets/skull.jpg"
+		}
+		npcs = append(npcs, NpcView{Key: char.Key, Name: char.Name, Race: char.Race, Image: char.Image, Wounded: woundedColor(char)})
+	}
+	return npcs
+}
+
+func initiativeView() InitiativeView {
+	view := InitiativeView{Round: world.Round, Entries: make([]InitiativeEntry, 0)}
+	if world.Initiativetxt == "" {
+		return view
+	}
+	if world.Round > 0 {
+		view.Turnstart = world.Turnstart
+	}
+	for i := range world.Outputar {
+		if world.Outputar[i] == "" {
+			continue
+		}
+		legendary := strings.TrimSpace(htmlTags.ReplaceAllString(renderLegendary(world.Outputar[i]), ""))
+		view.Entries = append(view.Entries, InitiativeEntry{Text: world.Outputar[i], Current: i == world.Currentturn, Legendary: legendary})
+	}
+	return view
+}
+
+// battleView is the attack msg describes when cmd is one, or nil.
+func battleView(msg string, cmd *Command) *BattleView {
+	if cmd.Name != "att" && cmd.Name != "ant" && cmd.Name != "act" && cmd.Name != "la" {
+		return nil
+	}
+	cchar := getCharAttacker(msg)
+	tchar := Char{}
+	if len(cmd.Args) < 2 || cmd.Name == "act" || cmd.Name == "la" {
+		tchar = getCharTarget(msg)
+	} else {
+		tchar = getNpcOrChar(cmd.Args[1])
+	}
+	if cchar.Name == "" || tchar.Name == "" {
+		return nil
+	}
+	return &BattleView{Attacker: cchar.Key, Target: tchar.Key, Text: msg}
+}
+
+func messageView(msg string, cmd *Command) MessageView {
+	switch cmd.Name {
+	case "msg":
+		return MessageView{Text: msg, Kind: "modal"}
+	case "v", "vo", "blog":
+		return MessageView{Text: msg, Kind: "view"}
+	}
+	return MessageView{Text: msg}
+}
+
+// worldUpdate is the whole table's view after a command that answered msg.
+// It isn't numbered until it is sent.
+func worldUpdate(msg string, cmd *Command) Update {
+	update := Update{Version: protocolVersion}
+	add := func(typ string, data interface{}) {
+		update.Messages = append(update.Messages, Message{Type: typ, Data: data})
+	}
+
+	add(sceneMessage, sceneView())
+	add(partyMessage, partyView())
+	add(npcsMessage, npcsView())
+	add(initiativeMessage, initiativeView())
+	battle := battleView(msg, cmd)
+	add(battleMessage, battle)
+	if battle != nil {
+		// the text goes with the attack
+		msg = ""
+	}
+	add(textMessage, messageView(msg, cmd))
+	add(musicMessage, MusicView{Track: world.Music})
+	return update
+}
+
+// madeEvent is whether m is a battle or message with something in it.
+func madeEvent(m Message) bool {
+	switch data := m.Data.(type) {
+	case *BattleView:
+		return data != nil
+	case MessageView:
+		return strings.TrimSpace(data.Text) != ""
+	}
+	return false
+}
+
+// memberKey is the key of a party or npcs member.
+func memberKey(member json.RawMessage) string {
+	m := struct{ Key string }{}
+	json.Unmarshal(member, &m)
+	return m.Key
+}
+
+// patchList is the members of a list that changed since it was last sent.
+func patchList(typ string, data json.RawMessage) (Message, bool) {
+	sent := make([]json.RawMessage, 0)
+	json.Unmarshal(viewState[typ], &sent)
+	old := make(map[string]json.RawMessage)
+	oldKeys := make([]string, 0)
+	for i := range sent {
+		key := memberKey(sent[i])
+		old[key] = sent[i]
+		oldKeys = append(oldKeys, key)
+	}
+
+	members := make([]json.RawMessage, 0)
+	json.Unmarshal(data, &members)
+	keys := make([]string, 0)
+	changed := make([]json.RawMessage, 0)
+	for i := range members {
+		key := memberKey(members[i])
+		keys = append(keys, key)
+		if !bytes.Equal(members[i], old[key]) {
+			changed = append(changed, members[i])
+		}
+	}
+
+	if len(changed) == 0 && strings.Join(keys, ",") == strings.Join(oldKeys, ",") {
+		return Message{}, false
+	}
+	return Message{Type: typ, Data: changed, Keys: keys}, true
+}
+
+// patchView is what changed in update since the view was last sent, and
+// any battle or message the command made. It becomes the view sent and, if
+// there is anything to send, gets the next number.
+func patchView(update Update) Update {
+	if viewState == nil {
+		viewState = make(map[string]json.RawMessage)
+	}
+
+	patch := Update{Version: protocolVersion, Messages: make([]Message, 0)}
+	for _, m := range update.Messages {
+		data, err := json.Marshal(m.Data)
+		if err != nil {
+			fmt.Println("Failed to encode ", m.Type, ": ", err)
+			continue
+		}
+		if listMessages[m.Type] {
+			if msg, changed := patchList(m.Type, data); changed {
+				patch.Messages = append(patch.Messages, msg)
+			}
+		} else if !bytes.Equal(data, viewState[m.Type]) || (eventMessages[m.Type] && madeEvent(m)) {
+			patch.Messages = append(patch.Messages, Message{Type: m.Type, Data: json.RawMessage(data)})
+		}
+		viewState[m.Type] = data
+	}
+
+	if len(patch.Messages) > 0 {
+		updateSeq++
+		patch.Seq = updateSeq
+	}
+	return patch
+}
+
+// fullUpdate is the whole view as last sent, for a client that is
+// connecting or has missed an update.
+func fullUpdate() []byte {
+	update := Update{Version: protocolVersion, Seq: updateSeq, Full: true, Messages: make([]Message, 0)}
+	for _, typ := range messageTypes {
+		if data, ok := viewState[typ]; ok {
+			update.Messages = append(update.Messages, Message{Type: typ, Data: data})
+		}
+	}
+	data, err := json.Marshal(update)
+	if err != nil {
+		fmt.Println("Failed to encode update: ", err)
+	}
+	return data
+}
+
+// renderWorld renders the world after a command that answered msg, as HTML
+// for the old page and as a patch for JSON clients.
+func renderWorld(msg string, cmd *Command) {
+	world.Lastoutput = renderContent(msg, cmd)
+	patch := patchView(worldUpdate(msg, cmd))
+	if len(patch.Messages) == 0 {
+		return
+	}
+	data, err := json.Marshal(patch)
+	if err != nil {
+		fmt.Println("Failed to encode update: ", err)
+		return
+	}
+	pendingUpdates = append(pendingUpdates, data)
+}
+
+// broadcastWorld sends the last render to every web client. JSON clients
+// are sent the patches they haven't had yet.
+func broadcastWorld() {
+	h.broadcast <- []byte(world.Lastoutput)
+	for i := range pendingUpdates {
+		h.jsonbroadcast <- pendingUpdates[i]
+	}
+	pendingUpdates = nil
+}
+
+// showWorld renders the world after msg and sends it to every web client.
+func showWorld(msg string, cmd *Command) {
+	renderWorld(msg, cmd)
+	broadcastWorld()
+}
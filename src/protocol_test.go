@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func protocolWorld(t *testing.T) {
+	simWorld(t, 30)
+	world.Places = []Place{{Key: "cave", Name: "The Cave", Image: "/assets/cave.jpg"}}
+	world.Place = "cave"
+	world.ShowParty = true
+	world.ShowNpcs = true
+	world.ShowMugs = true
+	world.Loot = make(map[string][]string)
+	world.Lootcoins = make(map[string]int)
+	setupSimFight([]string{"fig"}, []string{"gob"})
+}
+
+func TestWorldUpdate(t *testing.T) {
+	protocolWorld(t)
+	world.Npcs[0].CurHP = 5
+
+	update := worldUpdate("The goblin snarls.", &Command{Name: "msg"})
+	types := make([]string, 0)
+	for i := range update.Messages {
+		types = append(types, update.Messages[i].Type)
+	}
+	if update.Version != protocolVersion || strings.Join(types, " ") != "scene party npcs initiative battle message music" {
+		t.Log("Expected every part of the view but got ", update.Version, types)
+		t.Fail()
+	}
+
+	party := update.Messages[1].Data.([]PartyView)
+	if len(party) != 1 || party[0].Key != "fig" || party[0].HP != 40 {
+		t.Log("Expected the fighter at full hit points but got ", party)
+		t.Fail()
+	}
+	npcs := update.Messages[2].Data.([]NpcView)
+	if len(npcs) != 1 || npcs[0].Wounded != "red" {
+		t.Log("Expected a badly wounded goblin but got ", npcs)
+		t.Fail()
+	}
+
+	current := 0
+	for _, entry := range update.Messages[3].Data.(InitiativeView).Entries {
+		if entry.Current {
+			current++
+		}
+	}
+	if current != 1 {
+		t.Log("Expected one combatant on their turn but got ", current)
+		t.Fail()
+	}
+
+	if msg := update.Messages[5].Data.(MessageView); msg.Text != "The goblin snarls." || msg.Kind != "modal" {
+		t.Log("Expected the DM's message in a modal but got ", msg)
+		t.Fail()
+	}
+}
+
+func TestBattleUpdate(t *testing.T) {
+	protocolWorld(t)
+	gob := world.Npcs[0]
+
+	update := worldUpdate("Fighter attacks "+gob.Name+" with longsword", &Command{Name: "att", Args: []string{"fig.0", gob.Key}})
+	battle := update.Messages[4].Data.(*BattleView)
+	if battle == nil || battle.Attacker != "fig" || battle.Target != gob.Key {
+		t.Log("Expected the fighter attacking the goblin but got ", battle)
+		t.FailNow()
+	}
+	if update.Messages[5].Data.(MessageView).Text != "" {
+		t.Log("Expected the attack text only in the battle")
+		t.Fail()
+	}
+
+	// a second attack that reads the same is still shown
+	resetView()
+	patchView(update)
+	patch := patchView(update)
+	if len(patch.Messages) != 1 || patch.Messages[0].Type != battleMessage {
+		t.Log("Expected the attack sent again but got ", patch)
+		t.Fail()
+	}
+}
+
+// resetView forgets what JSON clients have been sent.
+func resetView() {
+	updateSeq = 0
+	viewState = nil
+	pendingUpdates = nil
+}
+
+func TestPatchView(t *testing.T) {
+	protocolWorld(t)
+	// the turn time isn't sent, only when the turn started
+	world.Turnstart = time.Now().Add(-time.Hour)
+	resetView()
+
+	patch := patchView(worldUpdate("", &Command{}))
+	if patch.Seq != 1 || len(patch.Messages) != len(messageTypes) {
+		t.Log("Expected the whole view first but got ", patch.Seq, len(patch.Messages))
+		t.Fail()
+	}
+
+	patch = patchView(worldUpdate("", &Command{}))
+	if patch.Seq != 0 || len(patch.Messages) != 0 || updateSeq != 1 {
+		t.Log("Expected nothing to send when nothing changed but got ", patch)
+		t.Fail()
+	}
+
+	world.Npcs[0].CurHP = 1
+	patch = patchView(worldUpdate("", &Command{}))
+	if patch.Seq != 2 || len(patch.Messages) != 1 || patch.Messages[0].Type != npcsMessage {
+		t.Log("Expected only the wounded goblin but got ", patch)
+		t.FailNow()
+	}
+	if len(patch.Messages[0].Data.([]json.RawMessage)) != 1 || strings.Join(patch.Messages[0].Keys, ",") != world.Npcs[0].Key {
+		t.Log("Expected one goblin and the keys of the list but got ", patch.Messages[0])
+		t.Fail()
+	}
+
+	world.Npcs = world.Npcs[:0]
+	patch = patchView(worldUpdate("", &Command{}))
+	if len(patch.Messages) != 1 || len(patch.Messages[0].Data.([]json.RawMessage)) != 0 || len(patch.Messages[0].Keys) != 0 {
+		t.Log("Expected an empty list of NPCs but got ", patch)
+		t.Fail()
+	}
+
+	// the same message again is still news
+	for i := 0; i < 2; i++ {
+		patch = patchView(worldUpdate("The goblin snarls.", &Command{Name: "msg"}))
+		if len(patch.Messages) != 1 || patch.Messages[0].Type != textMessage {
+			t.Log("Expected the message every time but got ", patch)
+			t.Fail()
+		}
+	}
+	patchView(worldUpdate("", &Command{}))
+	if patch = patchView(worldUpdate("", &Command{})); len(patch.Messages) != 0 {
+		t.Log("Expected no message once it was cleared but got ", patch)
+		t.Fail()
+	}
+}
+
+func TestJSONConnection(t *testing.T) {
+	homeTempl = template.Must(template.ParseFiles("home.html"))
+	testWorld(t)
+	os.Chdir(t.TempDir())
+	hubOnce.Do(func() { go h.run() })
+
+	doWork(func() {
+		protocolWorld(t)
+		resetView()
+		renderWorld("", &Command{})
+		broadcastWorld()
+	})
+
+	jsonconn := &connection{send: make(chan []byte, 256), json: true}
+	registerJSON(jsonconn)
+	defer func() { h.unregister <- jsonconn }()
+	htmlconn := &connection{send: make(chan []byte, 256)}
+	h.register <- htmlconn
+	defer func() { h.unregister <- htmlconn }()
+
+	update := Update{}
+	data := <-jsonconn.send
+	if json.Unmarshal(data, &update) != nil || update.Version != protocolVersion || !update.Full || update.Seq != 1 {
+		t.Log("Expected the whole view on connecting but got ", string(data))
+		t.Fail()
+	}
+
+	doWork(func() { showWorld("The goblin flees.", &Command{}) })
+	data = <-jsonconn.send
+	if !strings.Contains(string(data), "\"Seq\":2,\"Full\":false") || !strings.Contains(string(data), "\"Text\":\"The goblin flees.\"") {
+		t.Log("Expected the change as JSON but got ", string(data))
+		t.Fail()
+	}
+	data = <-htmlconn.send
+	if !strings.Contains(string(data), "<div id=\"mainarea\">") {
+		t.Log("Expected the page as HTML but got ", string(data))
+		t.Fail()
+	}
+
+	// a client that missed an update asks for the whole view again
+	jsonconn.request([]byte("{\"Type\":\"resync\"}"))
+	data = <-jsonconn.send
+	if json.Unmarshal(data, &update) != nil || !update.Full || update.Seq != 2 || !strings.Contains(string(data), "The goblin flees.") {
+		t.Log("Expected the whole view on a resync but got ", string(data))
+		t.Fail()
+	}
+}
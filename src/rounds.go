@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// CombatEvent identifies a point in the initiative order that other
+// features (conditions, regeneration, lair actions...) can hook into.
+type CombatEvent int
+
+const (
+	StartOfRound CombatEvent = iota
+	StartOfTurn
+	EndOfTurn
+)
+
+// combatHook is called with the char whose turn is starting or ending. For
+// StartOfRound the char is empty.
+type combatHook func(char Char)
+
+var combatHooks = make(map[CombatEvent][]combatHook)
+
+func onCombatEvent(ev CombatEvent, hook combatHook) {
+	combatHooks[ev] = append(combatHooks[ev], hook)
+}
+
+func fireCombatEvent(ev CombatEvent, char Char) {
+	for i := range combatHooks[ev] {
+		combatHooks[ev][i](char)
+	}
+}
+
+func inCombat() bool {
+	return len(world.Outputar) > 1
+}
+
+func turnElapsed() time.Duration {
+	if world.Turnstart.IsZero() {
+		return 0
+	}
+	return time.Since(world.Turnstart).Round(time.Second)
+}
+
+func startTurn() {
+	world.Turnstart = time.Now()
+	fireCombatEvent(StartOfTurn, getCharWithTurn())
+}
+
+func endTurn() {
+	cchar := getCharWithTurn()
+	sendConsole(fmt.Sprintf("%s's turn took %s\n", cchar.Name, turnElapsed()))
+	fireCombatEvent(EndOfTurn, cchar)
+}
+
+func startRound() {
+	world.Round++
+	sendConsole(fmt.Sprintf("Round %d\n", world.Round))
+	fireCombatEvent(StartOfRound, Char{})
+}
+
+func renderRoundTxt() string {
+	if world.Round == 0 {
+		return ""
+	}
+	return fmt.Sprintf("<span id=\"round\">Round %d</span> <span id=\"turntime\">(%s)</span><br>", world.Round, turnElapsed())
+}
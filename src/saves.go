@@ -0,0 +1,245 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// saveDir is where the active campaign's world is saved, saves/ under the
+// working directory for the default campaign and campaigns/NAME/saves for
+// the others.
+func saveDir() string {
+	return filepath.Join(campaignRoot(), "saves")
+}
+
+// Name of the save written every few commands and resumed on startup.
+const autosaveName = "autosave"
+
+var validSaveName = regexp.MustCompile("^[a-zA-Z0-9_-]+$")
+
+// Commands counted since the last autosave.
+var autosaveCount int
+
+// savedWorld is what a save file holds: the undo snapshot of the world and
+// the party it belongs to. Places and objects are left out, they come from
+// the assets when the save is loaded.
+type savedWorld struct {
+	Saved   time.Time
+	Players []string
+	World   json.RawMessage
+}
+
+func saveFile(name string) string {
+	return filepath.Join(saveDir(), name+".json")
+}
+
+// saveWorld writes the world to saves/NAME.json. The file is written
+// beside the old one and renamed over it so a crash can't leave half a save.
+func saveWorld(name string) error {
+	if !validSaveName.MatchString(name) {
+		return fmt.Errorf("save names are letters, numbers, - and _ only")
+	}
+
+	snap := worldSnapshot{}
+	err := json.Unmarshal(takeSnapshot(), &snap)
+	if err != nil {
+		return fmt.Errorf("could not snapshot the world: %v", err)
+	}
+	// the players are saved beside the world
+	snap.Players = nil
+	snap.Places = nil
+	snap.Objects = nil
+	play, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(savedWorld{Saved: time.Now(), Players: world.Players, World: play}, "", "\t")
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(saveDir(), 0755)
+	if err != nil {
+		return err
+	}
+	tmp := saveFile(name) + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, saveFile(name))
+}
+
+func readSave(name string) (savedWorld, error) {
+	saved := savedWorld{}
+	if !validSaveName.MatchString(name) {
+		return saved, fmt.Errorf("save names are letters, numbers, - and _ only")
+	}
+
+	data, err := ioutil.ReadFile(saveFile(name))
+	if err != nil {
+		return saved, err
+	}
+	err = json.Unmarshal(data, &saved)
+	if err == nil && len(saved.World) == 0 {
+		err = fmt.Errorf("%s has no world in it", saveFile(name))
+	}
+	return saved, err
+}
+
+// loadWorld puts the play in saves/NAME.json, party included, over the
+// world as the assets have it.
+func loadWorld(name string) (savedWorld, error) {
+	saved, err := readSave(name)
+	if err != nil {
+		return saved, err
+	}
+
+	world.Players = saved.Players
+	world.Charlist = strings.Join(saved.Players, ",")
+	restoreRuntime(saved.World)
+	return saved, nil
+}
+
+// restoreRuntime puts what happened in play back from a snapshot: the NPCs
+// dropped, hit points, loot, initiative and the place. Places, objects and
+// characters stay as the asset and player files have them now, so edits to
+// those since the snapshot still show. The snapshot's characters only give
+// the keys their hit points are kept under.
+func restoreRuntime(data []byte) {
+	snap := worldSnapshot{}
+	err := json.Unmarshal(data, &snap)
+	if err != nil {
+		fmt.Println("Failed to restore world: ", err)
+		return
+	}
+
+	chars := make([]Char, 0)
+	for i := range world.Chars {
+		if world.Chars[i].Playername == "" && !charIsNpc(world.Chars[i].Key) {
+			chars = append(chars, world.Chars[i])
+		}
+	}
+	for i := range world.Players {
+		if char, ok := runtimePlayerChar(world.Players[i], snap.Chars); ok {
+			chars = append(chars, char)
+		}
+	}
+
+	world.Npcs = snap.Npcs
+	carryKeys(chars, snap.Chars)
+	syncNpcs()
+	restorePlay(snap)
+}
+
+// runtimePlayerChar is playername's character from their player file, or
+// from saved if they have no file here.
+func runtimePlayerChar(playername string, saved []Char) (Char, bool) {
+	if _, err := os.Stat(playerFile(playername)); err == nil {
+		char := loadPlayerChar(playername)
+		char.Playername = playername
+		deriveStats(&char)
+		return char, true
+	}
+	for i := range saved {
+		if saved[i].Playername == playername {
+			return saved[i], true
+		}
+	}
+	return Char{}, false
+}
+
+// listSaves is the names of the saves on disk.
+func listSaves() []string {
+	names := make([]string, 0)
+	files, err := ioutil.ReadDir(saveDir())
+	if err != nil {
+		return names
+	}
+	for i := range files {
+		if strings.HasSuffix(files[i].Name(), ".json") {
+			names = append(names, strings.TrimSuffix(files[i].Name(), ".json"))
+		}
+	}
+	return names
+}
+
+// saveCommand handles "save [NAME]", saving to the autosave with no name or
+// listing the saves with "save list".
+func saveCommand(cmd Command) {
+	name := autosaveName
+	if len(cmd.Args) > 0 {
+		name = cmd.Args[0]
+	}
+
+	if name == "list" {
+		sendConsole(fmt.Sprintln("Saves:", strings.Join(listSaves(), ", ")))
+		return
+	}
+
+	err := saveWorld(name)
+	if err != nil {
+		sendConsole(fmt.Sprintln("Failed to save", name, ":", err))
+		return
+	}
+	sendConsole(fmt.Sprintln("Saved to", saveFile(name)))
+}
+
+// loadCommand handles "load [NAME]", loading the autosave with no name.
+func loadCommand(cmd Command) string {
+	name := autosaveName
+	if len(cmd.Args) > 0 {
+		name = cmd.Args[0]
+	}
+
+	saved, err := loadWorld(name)
+	if err != nil {
+		sendConsole(fmt.Sprintln("Failed to load", name, ":", err))
+		return ""
+	}
+	sendConsole(fmt.Sprintln("Loaded", name, "saved", saved.Saved.Format(time.RFC1123)))
+	return " "
+}
+
+// autosave saves the world every autosaveEvery state changing commands.
+func autosave() {
+	if *autosaveEvery <= 0 {
+		return
+	}
+	autosaveCount++
+	if autosaveCount < *autosaveEvery {
+		return
+	}
+
+	autosaveCount = 0
+	err := saveWorld(autosaveName)
+	if err != nil {
+		fmt.Println("Autosave failed: ", err)
+	}
+}
+
+// resumeAutosave loads the last autosave on startup, unless it was for a
+// different party than the one given with -chars.
+func resumeAutosave() {
+	saved, err := readSave(autosaveName)
+	if os.IsNotExist(err) {
+		return
+	}
+	if err != nil {
+		fmt.Println("Could not resume autosave: ", err)
+		return
+	}
+	if world.Charlist != "" && world.Charlist != strings.Join(saved.Players, ",") {
+		fmt.Println("Not resuming autosave for party", strings.Join(saved.Players, ","), "- load it with 'load'")
+		return
+	}
+
+	loadWorld(autosaveName)
+	fmt.Println("Resumed autosave from", saved.Saved.Format(time.RFC1123))
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestSaveAndLoad(t *testing.T) {
+	simWorld(t, 7)
+	os.Chdir(t.TempDir())
+	world.Players = []string{"bob"}
+	world.Npcs = []Char{{Name: "Goblin", Key: "gob1", CurHP: 3}}
+	world.Place = "cave"
+	world.Round = 3
+	setCharHP("fig", 4)
+	err := saveWorld("before_fight")
+	if err != nil {
+		t.Log("Failed to save: ", err)
+		t.Fail()
+	}
+
+	world.Place = "void"
+	world.Round = 0
+	setCharHP("fig", 12)
+	world.Npcs = nil
+	world.Players = nil
+	if msg := loadCommand(Command{Name: "load", Args: []string{"before_fight"}}); msg == "" {
+		t.Log("Expected load to redraw the page")
+		t.Fail()
+	}
+
+	if world.Place != "cave" || world.Round != 3 || getCharHP("fig") != 4 || len(world.Npcs) != 1 {
+		t.Log("Expected the saved fight back but got ", world.Place, world.Round, world.Combatants, world.Npcs)
+		t.Fail()
+	}
+	if len(world.Players) != 1 || world.Charlist != "bob" {
+		t.Log("Expected the saved party back but got ", world.Players)
+		t.Fail()
+	}
+
+	if names := listSaves(); len(names) != 1 || names[0] != "before_fight" {
+		t.Log("Expected one save but got ", names)
+		t.Fail()
+	}
+}
+
+func TestSaveNames(t *testing.T) {
+	testWorld(t)
+	os.Chdir(t.TempDir())
+
+	for _, name := range []string{"../assets/chars", "", "a b"} {
+		if err := saveWorld(name); err == nil {
+			t.Log("Expected ", name, " to be refused")
+			t.Fail()
+		}
+	}
+
+	if _, err := loadWorld("missing"); err == nil {
+		t.Log("Expected loading a missing save to fail")
+		t.Fail()
+	}
+}
+
+func TestResumeOtherParty(t *testing.T) {
+	simWorld(t, 7)
+	os.Chdir(t.TempDir())
+	world.Players = []string{"bob"}
+	world.Round = 2
+	saveWorld(autosaveName)
+
+	world.Round = 0
+	world.Charlist = "alice"
+	resumeAutosave()
+	if world.Round != 0 {
+		t.Log("Expected bob's autosave not to be resumed for alice")
+		t.Fail()
+	}
+
+	world.Charlist = "bob"
+	resumeAutosave()
+	if world.Round != 2 {
+		t.Log("Expected the autosave to be resumed but got round ", world.Round)
+		t.Fail()
+	}
+}
+
+func TestResumeEditedAssets(t *testing.T) {
+	campaignWorld(t)
+	ioutil.WriteFile("assets/places.json", []byte(`[{"Key": "cave", "Name": "The Cave"}]`), 0644)
+	ioutil.WriteFile("assets/chars.json", []byte(`[{"Name": "Goblin", "HP": 7}]`), 0644)
+	initialState(&world)
+	world.Place = "cave"
+	dropNpc("Goblin")
+	gob := world.Npcs[0].Key
+	world.Npcs[0].CurHP = 2
+	bob := playerKey("bob")
+	setCharHP(bob, 3)
+	saveWorld(autosaveName)
+
+	ioutil.WriteFile("assets/places.json", []byte(`[{"Key": "cave", "Name": "The Flooded Cave"}]`), 0644)
+	ioutil.WriteFile("assets/players/bob.json", []byte(`{"Name": "Bob", "HP": 12}`), 0644)
+	initialState(&world)
+	resumeAutosave()
+
+	if world.Place != "cave" || getPlace("cave").Name != "The Flooded Cave" {
+		t.Log("Expected the saved place as the assets have it now but got ", world.Place, getPlace("cave").Name)
+		t.Fail()
+	}
+	if len(world.Npcs) != 1 || world.Npcs[0].Key != gob || world.Npcs[0].CurHP != 2 || getChar(gob).Name != "Goblin" {
+		t.Log("Expected the wounded goblin back but got ", world.Npcs)
+		t.Fail()
+	}
+	if char := getChar(bob); char.HP != 12 || getCharHP(bob) != 3 {
+		t.Log("Expected bob's edited character with the saved hit points but got ", char.HP, getCharHP(bob))
+		t.Fail()
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Purse holds a character's coins.
+type Purse struct {
+	CP int
+	SP int
+	EP int
+	GP int
+	PP int
+}
+
+// Worth of each coin in copper.
+var coinValues = map[string]int{"cp": 1, "sp": 10, "ep": 50, "gp": 100, "pp": 1000}
+
+// Shops buy things back for this fraction of the price.
+const sellDivisor = 2
+
+func (p Purse) Value() int {
+	return p.CP + p.SP*10 + p.EP*50 + p.GP*100 + p.PP*1000
+}
+
+func (p Purse) String() string {
+	return formatCoins(p.Value())
+}
+
+// makeChange breaks copper into the fewest gold, silver and copper coins.
+func makeChange(cp int) Purse {
+	return Purse{GP: cp / 100, SP: (cp % 100) / 10, CP: cp % 10}
+}
+
+// formatCoins writes an amount of copper as gp, sp and cp.
+func formatCoins(cp int) string {
+	p := makeChange(cp)
+	parts := make([]string, 0)
+	if p.GP > 0 {
+		parts = append(parts, fmt.Sprintf("%d gp", p.GP))
+	}
+	if p.SP > 0 {
+		parts = append(parts, fmt.Sprintf("%d sp", p.SP))
+	}
+	if p.CP > 0 || len(parts) == 0 {
+		parts = append(parts, fmt.Sprintf("%d cp", p.CP))
+	}
+	return strings.Join(parts, " ")
+}
+
+// parseCoins reads an amount such as "15gp", "2 gp 5 sp" or "-3sp" into
+// copper. A bare number is gold.
+func parseCoins(amount string) (int, error) {
+	amount = strings.ToLower(strings.TrimSpace(amount))
+	sign := 1
+	if strings.HasPrefix(amount, "-") {
+		sign = -1
+		amount = amount[1:]
+	}
+
+	total := 0
+	fields := strings.Fields(amount)
+	for i := 0; i < len(fields); i++ {
+		field := fields[i]
+		// "2 gp" splits the number from its coin
+		if _, err := strconv.Atoi(field); err == nil && i+1 < len(fields) {
+			if _, ok := coinValues[fields[i+1]]; ok {
+				field = field + fields[i+1]
+				i++
+			}
+		}
+
+		coin := "gp"
+		num := field
+		for k := range coinValues {
+			if strings.HasSuffix(field, k) {
+				coin = k
+				num = strings.TrimSuffix(field, k)
+			}
+		}
+		n, err := strconv.Atoi(num)
+		if err != nil {
+			return 0, fmt.Errorf("bad amount %q", amount)
+		}
+		total = total + n*coinValues[coin]
+	}
+
+	if len(fields) == 0 {
+		return 0, fmt.Errorf("no amount")
+	}
+	return sign * total, nil
+}
+
+// pay takes cp from a purse, paying with copper, silver and gold and only
+// breaking electrum and platinum when those run out. It reports false
+// without touching the purse if there isn't enough.
+func pay(p *Purse, cp int) bool {
+	if p.Value() < cp {
+		return false
+	}
+
+	small := p.CP + p.SP*10 + p.GP*100
+	for small < cp && p.EP > 0 {
+		p.EP--
+		small = small + 50
+	}
+	for small < cp && p.PP > 0 {
+		p.PP--
+		small = small + 1000
+	}
+
+	change := makeChange(small - cp)
+	p.CP, p.SP, p.GP = change.CP, change.SP, change.GP
+	return true
+}
+
+func receive(p *Purse, cp int) {
+	change := makeChange(cp)
+	p.GP = p.GP + change.GP
+	p.SP = p.SP + change.SP
+	p.CP = p.CP + change.CP
+}
+
+func objectPrice(obj Object) int {
+	if obj.Price == "" {
+		return 0
+	}
+	price, err := parseCoins(obj.Price)
+	if err != nil {
+		fmt.Println("Bad price ", obj.Price, " for ", obj.Key)
+		return 0
+	}
+	return price
+}
+
+func sellPrice(obj Object) int {
+	return objectPrice(obj) / sellDivisor
+}
+
+func shopStock() []string {
+	return getPlace(world.Place).Shop
+}
+
+// buy moves the price of obj from char's purse and obj into its inventory,
+// or changes nothing and says why not.
+func buy(char *Char, key string) error {
+	if !hasItem(shopStock(), key) {
+		return fmt.Errorf("there is no %s for sale here", key)
+	}
+	obj := getObject(key)
+	price := objectPrice(obj)
+	if price <= 0 {
+		return fmt.Errorf("%s isn't for sale", obj.Name)
+	}
+	if !pay(&char.Purse, price) {
+		return fmt.Errorf("%s can't afford %s for %s", char.Name, obj.Name, formatCoins(price))
+	}
+
+	char.Inventory = append(char.Inventory, key)
+	saveHolder(char)
+	return nil
+}
+
+func sell(char *Char, key string) error {
+	if len(shopStock()) == 0 {
+		return fmt.Errorf("there is no shop here")
+	}
+	obj := getObject(key)
+	price := sellPrice(obj)
+	if price <= 0 {
+		return fmt.Errorf("the shop won't buy %s", key)
+	}
+	if !dropItem(char, key) {
+		return fmt.Errorf("%s isn't carrying %s", char.Name, key)
+	}
+
+	receive(&char.Purse, price)
+	saveHolder(char)
+	return nil
+}
+
+// shopCommand handles "buy KEY OBJ" and "sell KEY OBJ".
+func shopCommand(cmd Command) string {
+	if len(cmd.Args) < 2 {
+		sendConsole(fmt.Sprintf("Usage: %s KEY OBJECT\n", cmd.Name))
+		return ""
+	}
+
+	char := findHolder(cmd.Args[0])
+	if char == nil {
+		sendConsole(fmt.Sprintln("No one called", cmd.Args[0]))
+		return ""
+	}
+
+	var err error
+	price := objectPrice(getObject(cmd.Args[1]))
+	if cmd.Name == "sell" {
+		err = sell(char, cmd.Args[1])
+		price = sellPrice(getObject(cmd.Args[1]))
+	} else {
+		err = buy(char, cmd.Args[1])
+	}
+	if err != nil {
+		sendConsole(fmt.Sprintln(err))
+		return ""
+	}
+
+	return fmt.Sprintf("%s %ss %s for %s.", char.Name, cmd.Name, getObject(cmd.Args[1]).Name, formatCoins(price))
+}
+
+// coinsCommand handles "coins KEY [AMOUNT]", showing a purse or adding to
+// it, or taking from it with a negative amount.
+func coinsCommand(cmd Command) string {
+	if len(cmd.Args) < 1 {
+		sendConsole(fmt.Sprintln("Usage: coins KEY [AMOUNT]"))
+		return ""
+	}
+
+	char := findHolder(cmd.Args[0])
+	if char == nil {
+		sendConsole(fmt.Sprintln("No one called", cmd.Args[0]))
+		return ""
+	}
+
+	if len(cmd.Args) > 1 {
+		amount, err := parseCoins(strings.Join(cmd.Args[1:], " "))
+		if err != nil {
+			sendConsole(fmt.Sprintln(err))
+			return ""
+		}
+		if amount < 0 && !pay(&char.Purse, -amount) {
+			sendConsole(fmt.Sprintln(char.Name, "only has", char.Purse))
+			return ""
+		}
+		if amount > 0 {
+			receive(&char.Purse, amount)
+		}
+		saveHolder(char)
+	}
+
+	sendConsole(fmt.Sprintf("%s has %d pp %d gp %d ep %d sp %d cp (%s)\n", char.Name, char.Purse.PP, char.Purse.GP, char.Purse.EP, char.Purse.SP, char.Purse.CP, char.Purse))
+	if len(cmd.Args) > 1 {
+		return " "
+	}
+	return ""
+}
+
+func renderShopLink() string {
+	if len(shopStock()) == 0 {
+		return ""
+	}
+	return "<div id=\"shoplink\"><a class=\"claim\" href=\"/shop\">Shop</a></div>"
+}
+
+func renderShop(char Char, msg string) string {
+	output := fmt.Sprintf("<div id=\"shop\"><p>%s</p><p>%s has %s</p><b>For sale</b><br>", msg, char.Name, char.Purse)
+	stock := shopStock()
+	for i := range stock {
+		obj := getObject(stock[i])
+		output = output + fmt.Sprintf("%s %s %s<br>", obj.Name, formatCoins(objectPrice(obj)), postButton("trade", "/shop", "buy", obj.Key, "Buy"))
+	}
+
+	output = output + "<br><b>Sell</b><br>"
+	for i := range char.Inventory {
+		obj := getObject(char.Inventory[i])
+		if sellPrice(obj) > 0 {
+			output = output + fmt.Sprintf("%s %s %s<br>", obj.Name, formatCoins(sellPrice(obj)), postButton("trade", "/shop", "sell", obj.Key, "Sell"))
+		}
+	}
+	return output + "</div>"
+}
+
+// shopHandler lets a player buy and sell at the shop in the current place.
+func shopHandler(c http.ResponseWriter, req *http.Request) {
+	req.ParseForm()
+
+	playername := cookiePlayer(req)
+	if playername == "" {
+		playerIdTempl.Execute(c, nil)
+		return
+	}
+	i := -1
+	for k := range world.Chars {
+		if world.Chars[k].Playername == playername {
+			i = k
+		}
+	}
+	if i == -1 || len(shopStock()) == 0 {
+		http.Redirect(c, req, "/", 302)
+		return
+	}
+
+	msg := ""
+	var err error
+	if key := req.PostFormValue("buy"); key != "" {
+		err = buy(&world.Chars[i], key)
+		msg = fmt.Sprintf("%s buys %s.", world.Chars[i].Name, getObject(key).Name)
+	} else if key := req.PostFormValue("sell"); key != "" {
+		err = sell(&world.Chars[i], key)
+		msg = fmt.Sprintf("%s sells %s.", world.Chars[i].Name, getObject(key).Name)
+	}
+	if err != nil {
+		msg = err.Error()
+	} else if msg != "" {
+		fmt.Println(msg)
+		logEvent(coinsEvent, "shop", []string{world.Chars[i].Key}, msg)
+		showWorld(msg, &Command{})
+	}
+
+	mainData := MainData{Host: req.Host, Content: renderShop(world.Chars[i], msg)}
+	homeTempl.Execute(c, mainData)
+}
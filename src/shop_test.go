@@ -0,0 +1,74 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseCoins(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   int
+	}{
+		{"15gp", 1500},
+		{"2 gp 5 sp", 250},
+		{"-3sp", -30},
+		{"7", 700},
+		{"1pp 1ep 1cp", 1051},
+	}
+
+	for _, tt := range tests {
+		if got, err := parseCoins(tt.amount); err != nil || got != tt.want {
+			t.Log("Expected ", tt.want, " cp for ", tt.amount, " but got ", got, err)
+			t.Fail()
+		}
+	}
+
+	if _, err := parseCoins("lots"); err == nil {
+		t.Log("Expected an error for lots")
+		t.Fail()
+	}
+}
+
+func TestPay(t *testing.T) {
+	p := Purse{GP: 2, SP: 2, PP: 1}
+	if !pay(&p, 150) || p.GP != 0 || p.SP != 7 || p.PP != 1 {
+		t.Log("Expected change from the gold before breaking platinum but got ", p)
+		t.Fail()
+	}
+
+	if !pay(&p, 500) || p.PP != 0 || p.Value() != 570 {
+		t.Log("Expected the platinum broken for 5 gp but got ", p)
+		t.Fail()
+	}
+
+	before := p
+	if pay(&p, 10000) || p != before {
+		t.Log("Expected paying too much to leave the purse alone but got ", p)
+		t.Fail()
+	}
+}
+
+func TestBuyAndSell(t *testing.T) {
+	simWorld(t, 7)
+	world.Objects = []Object{{Key: "lsw", Name: "longsword", Price: "15 gp"}}
+	world.Places = []Place{{Key: "market", Shop: []string{"lsw"}}}
+	world.Place = "market"
+	char := &world.Chars[0]
+	char.Purse = Purse{GP: 10}
+
+	if buy(char, "lsw") == nil || len(char.Inventory) != 0 || char.Purse.GP != 10 {
+		t.Log("Expected 10 gp not to buy a longsword")
+		t.Fail()
+	}
+
+	char.Purse.GP = 20
+	if err := buy(char, "lsw"); err != nil || !hasItem(char.Inventory, "lsw") || char.Purse.Value() != 500 {
+		t.Log("Expected to buy the longsword for 15 gp but got ", err, char.Purse)
+		t.Fail()
+	}
+
+	if err := sell(char, "lsw"); err != nil || len(char.Inventory) != 0 || char.Purse.Value() != 1250 {
+		t.Log("Expected to sell the longsword for 7 gp 5 sp but got ", err, char.Purse)
+		t.Fail()
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Give up on a simulated fight that nobody is winning.
+const simMaxRounds = 100
+
+var (
+	// headless runs combat without broadcasting, pausing or console output.
+	headless bool
+	// simRand, when set, replaces the dice roller with a seeded local one.
+	simRand *rand.Rand
+)
+
+type simResult struct {
+	Runs      int
+	Wins      int
+	Rounds    int
+	Anydown   int
+	Down      map[string]int
+	Hpleft    map[string]int
+	Party     []Char
+	Npcs      []string
+	Stalemate int
+}
+
+// rollSimDice rolls dicestring with r, in the same text format as the
+// rolldice tool.
+func rollSimDice(r *rand.Rand, dicestring string) string {
+	num, size, bonus, err := parseDice(dicestring)
+	if err != nil {
+		fmt.Println("Bad dice string ", dicestring, err)
+		return "0"
+	}
+
+	roll := bonus
+	for i := 0; i < num; i++ {
+		roll = roll + r.Intn(size) + 1
+	}
+	return fmt.Sprintf("%d\n", roll)
+}
+
+// setupSimFight puts the party in the party and everybody else out of it,
+// heals them and drops a fresh set of npcs.
+func setupSimFight(party []string, npcs []string) {
+	for i := range world.Chars {
+		world.Chars[i].InParty = false
+		for k := range party {
+			if world.Chars[i].Key == party[k] {
+				world.Chars[i].InParty = true
+				setCharHP(world.Chars[i].Key, world.Chars[i].HP)
+			}
+		}
+	}
+
+	initNpcs()
+	for i := range npcs {
+		dropNpc(npcs[i])
+	}
+	world.Initiativetxt = rollInitiatives("")
+}
+
+// simulate runs the party against npcs runs times and restores the world
+// afterwards. Party and npcs are char keys; npcs may repeat.
+func simulate(party []string, npcs []string, runs int, seed int64) simResult {
+	res := simResult{Runs: runs, Npcs: npcs, Down: make(map[string]int), Hpleft: make(map[string]int)}
+	for i := range party {
+		char := getChar(party[i])
+		if char.Name == "" {
+			sendConsole(fmt.Sprintln("Unknown party member", party[i]))
+			return res
+		}
+		res.Party = append(res.Party, char)
+	}
+	for i := range npcs {
+		if getChar(npcs[i]).Name == "" {
+			sendConsole(fmt.Sprintln("Unknown npc", npcs[i]))
+			return res
+		}
+	}
+
+	saved := takeSnapshot()
+	washeadless := headless
+	headless = true
+	simRand = rand.New(rand.NewSource(seed))
+	defer func() {
+		headless = washeadless
+		simRand = nil
+		restoreSnapshot(saved)
+	}()
+
+	for run := 0; run < runs; run++ {
+		restoreSnapshot(saved)
+		setupSimFight(party, npcs)
+		autoFight()
+
+		if allndead() && !allpdead() {
+			res.Wins++
+		} else if !allndead() && !allpdead() {
+			res.Stalemate++
+		}
+		res.Rounds = res.Rounds + world.Round
+
+		anydown := false
+		for i := range res.Party {
+			hp := getHP(res.Party[i].Key)
+			if hp <= 0 {
+				res.Down[res.Party[i].Key]++
+				anydown = true
+			} else {
+				res.Hpleft[res.Party[i].Key] = res.Hpleft[res.Party[i].Key] + hp
+			}
+		}
+		if anydown {
+			res.Anydown++
+		}
+	}
+
+	return res
+}
+
+func (res simResult) String() string {
+	if res.Runs == 0 {
+		return "No runs.\n"
+	}
+
+	output := fmt.Sprintf("%d fights of %s vs %s\n", res.Runs, simPartyNames(res.Party), strings.Join(res.Npcs, ","))
+	output = output + fmt.Sprintf("Party wins: %.1f%%\n", percent(res.Wins, res.Runs))
+	if res.Stalemate > 0 {
+		output = output + fmt.Sprintf("Unfinished after %d rounds: %.1f%%\n", simMaxRounds, percent(res.Stalemate, res.Runs))
+	}
+	output = output + fmt.Sprintf("Average rounds: %.1f\n", float64(res.Rounds)/float64(res.Runs))
+	output = output + fmt.Sprintf("Someone goes down: %.1f%%\n", percent(res.Anydown, res.Runs))
+	for i := range res.Party {
+		key := res.Party[i].Key
+		up := res.Runs - res.Down[key]
+		avghp := 0.0
+		if up > 0 {
+			avghp = float64(res.Hpleft[key]) / float64(up)
+		}
+		output = output + fmt.Sprintf("  %s: down %.1f%%, %.1f/%d HP left when standing\n", res.Party[i].Name, percent(res.Down[key], res.Runs), avghp, res.Party[i].HP)
+	}
+	return output
+}
+
+func percent(n int, total int) float64 {
+	return float64(n) * 100 / float64(total)
+}
+
+func simPartyNames(party []Char) string {
+	names := make([]string, 0)
+	for i := range party {
+		names = append(names, party[i].Name)
+	}
+	return strings.Join(names, ",")
+}
+
+// currentParty is the keys of the party members, used when sim is not
+// told who to send in.
+func currentParty() []string {
+	party := make([]string, 0)
+	for i := range world.Chars {
+		if world.Chars[i].InParty && !charIsNpc(world.Chars[i].Key) {
+			party = append(party, world.Chars[i].Key)
+		}
+	}
+	sort.Strings(party)
+	return party
+}
+
+// simCommand handles "sim npcs=KEY,KEY [party=KEY,KEY] [n=RUNS] [seed=SEED]".
+// Most fights sim runs from the console. The fights run as one processor
+// job and hold up every player and autof until they are done; the sim
+// subcommand runs as many as asked without a server to hold up.
+const maxConsoleSimRuns = 200
+
+func simCommand(cmd Command) {
+	npcs := make([]string, 0)
+	party := currentParty()
+	runs := maxConsoleSimRuns
+	seed := time.Now().UnixNano()
+
+	for i := range cmd.Args {
+		kv := strings.SplitN(cmd.Args[i], "=", 2)
+		if len(kv) != 2 {
+			continue
+		}
+		if kv[0] == "npcs" {
+			npcs = strings.Split(kv[1], ",")
+		} else if kv[0] == "party" {
+			party = strings.Split(kv[1], ",")
+		} else if kv[0] == "n" {
+			runs, _ = strconv.Atoi(kv[1])
+		} else if kv[0] == "seed" {
+			seed, _ = strconv.ParseInt(kv[1], 10, 64)
+		}
+	}
+
+	if len(npcs) == 0 {
+		sendConsole(fmt.Sprintln("Usage: sim npcs=KEY,KEY [party=KEY,KEY] [n=RUNS] [seed=SEED]"))
+		return
+	}
+
+	if runs > maxConsoleSimRuns {
+		sendConsole(fmt.Sprintf("Running %d fights, run dmhelper sim for more.\n", maxConsoleSimRuns))
+		runs = maxConsoleSimRuns
+	}
+
+	res := simulate(party, npcs, runs, seed)
+	sendConsole(res.String())
+}
+
+// runSim is the "sim" subcommand, run from the command line without
+// starting the server.
+func runSim(args []string) {
+	fs := flag.NewFlagSet("sim", flag.ExitOnError)
+	npcs := fs.String("npcs", "", "NPC keys to fight, separated by commas. Repeat a key for more than one.")
+	party := fs.String("party", "", "Party member keys separated by commas, defaults to everyone in the party.")
+	runs := fs.Int("n", 1000, "Number of fights to run.")
+	seed := fs.Int64("seed", time.Now().UnixNano(), "Random seed.")
+	fs.Parse(args)
+
+	if *npcs == "" {
+		fs.Usage()
+		return
+	}
+
+	go h.run()
+	initialState(&world)
+
+	p := currentParty()
+	if *party != "" {
+		p = strings.Split(*party, ",")
+	}
+
+	res := simulate(p, strings.Split(*npcs, ","), *runs, *seed)
+	fmt.Print(res.String())
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"testing"
+)
+
+// simWorld sets up a party of one fighter and a goblin stat block without
+// touching the asset files.
+func simWorld(t *testing.T, goblinHP int) {
+	testWorld(t)
+	world.Chars = []Char{
+		{Name: "Fighter", Key: "fig", InParty: true, HP: 40, AC: 18,
+			Attacks: []Attack{{Name: "longsword", Verb: "slashes", Hitbonus: 6, Damageroll: "1d8+4"}}},
+		{Name: "Goblin", Key: "gob", HP: goblinHP, AC: 12,
+			Attacks: []Attack{{Name: "scimitar", Verb: "slashes", Hitbonus: 4, Damageroll: "1d6+2"}}},
+	}
+	setCharHP("fig", 40)
+	setCharHP("gob", goblinHP)
+	world.Players = []string{""}
+	clearActions()
+	clearLegendary()
+	clearFled()
+}
+
+func TestSimulateIsRepeatable(t *testing.T) {
+	simWorld(t, 7)
+	res1 := simulate([]string{"fig"}, []string{"gob", "gob"}, 200, 42)
+	simWorld(t, 7)
+	res2 := simulate([]string{"fig"}, []string{"gob", "gob"}, 200, 42)
+
+	if res1.String() != res2.String() {
+		t.Log("Expected the same results for the same seed but got\n", res1, "and\n", res2)
+		t.Fail()
+	}
+}
+
+func TestSimulateOdds(t *testing.T) {
+	simWorld(t, 7)
+	headless = false
+	res := simulate([]string{"fig"}, []string{"gob"}, 500, 1)
+
+	if res.Runs != 500 || res.Wins < 490 {
+		t.Log("Expected a fighter to nearly always beat one goblin but got\n", res)
+		t.Fail()
+	}
+
+	if res.Rounds == 0 {
+		t.Log("Expected rounds to be counted")
+		t.Fail()
+	}
+
+	// the world is put back the way it was
+	if len(world.Npcs) != 0 || getCharHP("fig") != 40 || headless || simRand != nil {
+		t.Log("Expected simulate to restore the world")
+		t.Fail()
+	}
+}
+
+func TestSimulateKeepsHeadless(t *testing.T) {
+	simWorld(t, 7)
+	headless = true
+
+	simulate([]string{"fig"}, []string{"gob"}, 5, 42)
+	if !headless {
+		t.Log("Expected simulate to leave the console quiet as it was")
+		t.Fail()
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Strategy decides how a combatant behaves when autoFight runs its turn.
+// Which one a char uses is set with "Strategy" in chars.json; "FleeAt" is
+// the percentage of HP below which it runs, whatever the strategy.
+type Strategy interface {
+	// chooseTarget picks one of the live targets.
+	chooseTarget(char Char, targets []Char) Char
+	// shouldFlee reports whether char gives up the fight this turn.
+	shouldFlee(char Char) bool
+}
+
+var strategies = map[string]Strategy{
+	"random":   randomStrategy{},
+	"lowesthp": lowestHPStrategy{},
+	"threat":   threatStrategy{},
+	"caster":   casterStrategy{},
+	"flee":     fleeStrategy{},
+}
+
+// Casters are targeted by the caster strategy even with empty spell lists.
+var casterClasses = []string{"bard", "cleric", "druid", "sorcerer", "warlock", "wizard"}
+
+func getStrategy(char Char) Strategy {
+	strat, ok := strategies[strings.ToLower(char.Strategy)]
+	if !ok {
+		if char.Strategy != "" {
+			sendConsole(fmt.Sprintln("Unknown strategy", char.Strategy, "for", char.Name, "using random"))
+		}
+		return randomStrategy{}
+	}
+	return strat
+}
+
+func hpPercent(char Char) int {
+	if char.HP == 0 {
+		return 0
+	}
+	return getHP(char.Key) * 100 / char.HP
+}
+
+func belowFleeAt(char Char) bool {
+	return char.FleeAt > 0 && hpPercent(char) < char.FleeAt
+}
+
+type randomStrategy struct{}
+
+func (s randomStrategy) chooseTarget(char Char, targets []Char) Char {
+	// NPCs turn on those of other races four times in ten
+	if !char.InParty {
+		if others := otherRaceNpcs(char); len(others) > 0 && rollInt("1d10") < 5 {
+			targets = others
+		}
+	}
+
+	ran := rollInt(fmt.Sprintf("1d%d", len(targets)))
+	if ran < 1 || ran > len(targets) {
+		ran = 1
+	}
+	return targets[ran-1]
+}
+
+func (s randomStrategy) shouldFlee(char Char) bool {
+	return belowFleeAt(char)
+}
+
+type lowestHPStrategy struct{}
+
+func (s lowestHPStrategy) chooseTarget(char Char, targets []Char) Char {
+	target := targets[0]
+	for i := range targets {
+		if getHP(targets[i].Key) < getHP(target.Key) {
+			target = targets[i]
+		}
+	}
+	return target
+}
+
+func (s lowestHPStrategy) shouldFlee(char Char) bool {
+	return belowFleeAt(char)
+}
+
+// threatStrategy goes for whoever can hurt char the most.
+type threatStrategy struct{}
+
+func (s threatStrategy) chooseTarget(char Char, targets []Char) Char {
+	target := targets[0]
+	threat := expectedActionDamage(target, char)
+	for i := range targets {
+		t := expectedActionDamage(targets[i], char)
+		if t > threat {
+			target = targets[i]
+			threat = t
+		}
+	}
+	return target
+}
+
+func (s threatStrategy) shouldFlee(char Char) bool {
+	return belowFleeAt(char)
+}
+
+// casterStrategy picks off spellcasters first, weakest first, and falls back
+// to the lowest HP target when there are none.
+type casterStrategy struct{}
+
+func (s casterStrategy) chooseTarget(char Char, targets []Char) Char {
+	casters := make([]Char, 0)
+	for i := range targets {
+		if isSpellcaster(targets[i]) {
+			casters = append(casters, targets[i])
+		}
+	}
+
+	if len(casters) == 0 {
+		return lowestHPStrategy{}.chooseTarget(char, targets)
+	}
+	return lowestHPStrategy{}.chooseTarget(char, casters)
+}
+
+func (s casterStrategy) shouldFlee(char Char) bool {
+	return belowFleeAt(char)
+}
+
+// fleeStrategy fights like random but runs at a quarter HP unless FleeAt
+// says otherwise.
+type fleeStrategy struct{}
+
+func (s fleeStrategy) chooseTarget(char Char, targets []Char) Char {
+	return randomStrategy{}.chooseTarget(char, targets)
+}
+
+func (s fleeStrategy) shouldFlee(char Char) bool {
+	if char.FleeAt > 0 {
+		return belowFleeAt(char)
+	}
+	return hpPercent(char) < 25
+}
+
+func isSpellcaster(char Char) bool {
+	spells := char.SpellL1 + char.SpellL2 + char.SpellL3 + char.SpellL4 + char.SpellL5 + char.SpellL6 + char.SpellL7 + char.SpellL8 + char.SpellL9
+	if strings.TrimSpace(spells) != "" {
+		return true
+	}
+
+	for i := range casterClasses {
+		if strings.ToLower(char.Class) == casterClasses[i] {
+			return true
+		}
+	}
+	return false
+}
+
+// bestAttack is the index of char's attack with the highest expected damage
+// against target.
+func bestAttack(char Char, target Char) int {
+	best := 0
+	dmg := -1.0
+	for i := range char.Attacks {
+		e := expectedDamage(char.Attacks[i], target.AC)
+		if e > dmg {
+			best = i
+			dmg = e
+		}
+	}
+	return best
+}
+
+// expectedActionDamage is what char's action is worth against target, using
+// its multiattack if it has one.
+func expectedActionDamage(char Char, target Char) float64 {
+	if len(char.Attacks) == 0 {
+		return 0
+	}
+
+	if len(char.Multiattack) == 0 {
+		return expectedDamage(char.Attacks[bestAttack(char, target)], target.AC)
+	}
+
+	total := 0.0
+	seq := attackSequence(char)
+	for i := range seq {
+		if seq[i] < len(char.Attacks) {
+			total = total + expectedDamage(char.Attacks[seq[i]], target.AC)
+		}
+	}
+	return total
+}
+
+// liveTargets returns who char can attack: the NPCs still standing for a
+// party member, the party for everyone else.
+func liveTargets(char Char) []Char {
+	targets := make([]Char, 0)
+	if char.InParty {
+		for i := range world.Npcs {
+			if world.Npcs[i].CurHP > 0 && !getCombatant(world.Npcs[i].Key).Fled {
+				targets = append(targets, world.Npcs[i])
+			}
+		}
+	} else {
+		for i := range world.Chars {
+			if world.Chars[i].InParty && getHP(world.Chars[i].Key) > 0 {
+				targets = append(targets, world.Chars[i])
+			}
+		}
+	}
+	return targets
+}
+
+// otherRaceNpcs returns the NPCs still standing that aren't char's race.
+func otherRaceNpcs(char Char) []Char {
+	others := make([]Char, 0)
+	for i := range world.Npcs {
+		npc := world.Npcs[i]
+		if npc.Key != char.Key && npc.Race != char.Race && npc.CurHP > 0 && !getCombatant(npc.Key).Fled {
+			others = append(others, npc)
+		}
+	}
+	return others
+}
+
+func clearFled() {
+	updateCombatants(func(c *Combatant) { c.Fled = false })
+}
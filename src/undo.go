@@ -0,0 +1,291 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Number of commands kept in the undo history.
+const undoLimit = 50
+
+// Commands that change world state and can be undone.
+var undoableCommands = map[string]bool{
+	"drop":      true,
+	"dropran":   true,
+	"build":     true,
+	"xp":        true,
+	"milestone": true,
+	"buy":       true,
+	"sell":      true,
+	"coins":     true,
+	"give":      true,
+	"take":      true,
+	"loot":      true,
+	"rollloot":  true,
+	"equip":     true,
+	"unequip":   true,
+	"place":     true,
+	"p":         true,
+	"sethp":     true,
+	"subhp":     true,
+	"addhp":     true,
+	"t":         true,
+	"music":     true,
+	"sp":        true,
+	"snp":       true,
+	"smugs":     true,
+	"clearnpcs": true,
+	"combat":    true,
+	"endcombat": true,
+	"reset":     true,
+	"att":       true,
+	"ant":       true,
+	"act":       true,
+	"la":        true,
+	"lair":      true,
+	"nt":        true,
+	"pt":        true,
+	"re":        true,
+	"reload":    true,
+	"load":      true,
+}
+
+// Undoable commands that also write player files. Undo and redo put the
+// files back too, or the next reload would bring the change back.
+var fileCommands = map[string]bool{
+	"xp":        true,
+	"milestone": true,
+	"endcombat": true,
+	"equip":     true,
+	"unequip":   true,
+	"give":      true,
+	"take":      true,
+	"buy":       true,
+	"sell":      true,
+	"coins":     true,
+}
+
+// worldSnapshot is the part of WorldState that DM commands change, the
+// party included. Login state and the static rule tables are left alone by
+// undo.
+type worldSnapshot struct {
+	Players       []string
+	Places        []Place
+	Chars         []Char
+	Npcs          []Char
+	Objects       []Object
+	Loot          map[string][]string
+	Lootcoins     map[string]int
+	Place         string
+	NoText        bool
+	ShowParty     bool
+	ShowNpcs      bool
+	ShowMugs      bool
+	Initiativetxt string
+	Combatants    map[string]Combatant
+	Lastbattlemsg string
+	Battlelog     string
+	Outputar      []string
+	Currentturn   int
+	Round         int
+	Turnstart     time.Time
+	Lairdone      bool
+	Combatexp     int
+	Milestone     bool
+	Music         string
+}
+
+type undoOp struct {
+	Cmd    string
+	Before []byte
+	After  []byte
+	// player files by player name, for fileCommands
+	FilesBefore map[string][]byte
+	FilesAfter  map[string][]byte
+}
+
+var (
+	undoHistory []undoOp
+	redoHistory []undoOp
+)
+
+func takeSnapshot() []byte {
+	snap := worldSnapshot{
+		Players:       world.Players,
+		Places:        world.Places,
+		Chars:         world.Chars,
+		Npcs:          world.Npcs,
+		Objects:       world.Objects,
+		Loot:          world.Loot,
+		Lootcoins:     world.Lootcoins,
+		Place:         world.Place,
+		NoText:        world.NoText,
+		ShowParty:     world.ShowParty,
+		ShowNpcs:      world.ShowNpcs,
+		ShowMugs:      world.ShowMugs,
+		Initiativetxt: world.Initiativetxt,
+		Combatants:    world.Combatants,
+		Lastbattlemsg: world.Lastbattlemsg,
+		Battlelog:     world.Battlelog,
+		Outputar:      world.Outputar,
+		Currentturn:   world.Currentturn,
+		Round:         world.Round,
+		Turnstart:     world.Turnstart,
+		Lairdone:      world.Lairdone,
+		Combatexp:     world.Combatexp,
+		Milestone:     world.Milestone,
+		Music:         world.Music,
+	}
+
+	// marshalling gives us a deep copy of the slices and maps
+	data, err := json.Marshal(snap)
+	if err != nil {
+		fmt.Println("Failed to snapshot world: ", err)
+		return nil
+	}
+	return data
+}
+
+func restoreSnapshot(data []byte) {
+	snap := worldSnapshot{}
+	err := json.Unmarshal(data, &snap)
+	if err != nil {
+		fmt.Println("Failed to restore world: ", err)
+		return
+	}
+
+	world.Players = snap.Players
+	if world.Players == nil {
+		world.Players = make([]string, 0)
+	}
+	world.Charlist = strings.Join(world.Players, ",")
+	world.Places = snap.Places
+	world.Chars = snap.Chars
+	world.Npcs = snap.Npcs
+	world.Objects = snap.Objects
+	restorePlay(snap)
+}
+
+// restorePlay puts back the state of play in snap, everything but the
+// places, objects and characters.
+func restorePlay(snap worldSnapshot) {
+	world.Loot = snap.Loot
+	if world.Loot == nil {
+		world.Loot = make(map[string][]string)
+	}
+	world.Lootcoins = snap.Lootcoins
+	if world.Lootcoins == nil {
+		world.Lootcoins = make(map[string]int)
+	}
+	world.Place = snap.Place
+	world.NoText = snap.NoText
+	world.ShowParty = snap.ShowParty
+	world.ShowNpcs = snap.ShowNpcs
+	world.ShowMugs = snap.ShowMugs
+	world.Initiativetxt = snap.Initiativetxt
+	world.Combatants = snap.Combatants
+	if world.Combatants == nil {
+		world.Combatants = make(map[string]Combatant)
+	}
+	world.Lastbattlemsg = snap.Lastbattlemsg
+	world.Battlelog = snap.Battlelog
+	world.Outputar = snap.Outputar
+	world.Currentturn = snap.Currentturn
+	world.Round = snap.Round
+	world.Turnstart = snap.Turnstart
+	world.Lairdone = snap.Lairdone
+	world.Combatexp = snap.Combatexp
+	world.Milestone = snap.Milestone
+	world.Music = snap.Music
+}
+
+// playerFiles reads the files of the players in the campaign.
+func playerFiles() map[string][]byte {
+	files := make(map[string][]byte)
+	for i := range world.Players {
+		data, err := ioutil.ReadFile(playerFile(world.Players[i]))
+		if err == nil {
+			files[world.Players[i]] = data
+		}
+	}
+	return files
+}
+
+func restorePlayerFiles(files map[string][]byte) {
+	for player, data := range files {
+		err := writePlayerFile(player, data)
+		if err != nil {
+			fmt.Println("Failed to restore ", player, ": ", err)
+		}
+	}
+}
+
+// commandFiles is the player files before cmd runs, if it writes them.
+func commandFiles(cmd Command) map[string][]byte {
+	if !fileCommands[cmd.Name] {
+		return nil
+	}
+	return playerFiles()
+}
+
+// recordUndo pushes cmd onto the undo history if it changed anything since
+// the before snapshot was taken. A new command invalidates the redo history.
+func recordUndo(cmd Command, before []byte, filesBefore map[string][]byte) {
+	after := takeSnapshot()
+	if before == nil || after == nil || bytes.Equal(before, after) {
+		return
+	}
+
+	op := undoOp{Cmd: strings.TrimSpace(cmd.Name + " " + cmd.RawArgs), Before: before, After: after}
+	if filesBefore != nil {
+		op.FilesBefore = filesBefore
+		op.FilesAfter = playerFiles()
+	}
+	undoHistory = append(undoHistory, op)
+	if len(undoHistory) > undoLimit {
+		undoHistory = undoHistory[len(undoHistory)-undoLimit:]
+	}
+	redoHistory = nil
+}
+
+func undo() bool {
+	if len(undoHistory) == 0 {
+		sendConsole(fmt.Sprintln("Nothing to undo."))
+		return false
+	}
+
+	op := undoHistory[len(undoHistory)-1]
+	undoHistory = undoHistory[:len(undoHistory)-1]
+	restoreSnapshot(op.Before)
+	restorePlayerFiles(op.FilesBefore)
+	redoHistory = append(redoHistory, op)
+	sendConsole(fmt.Sprintln("Undid:", op.Cmd))
+	return true
+}
+
+func redo() bool {
+	if len(redoHistory) == 0 {
+		sendConsole(fmt.Sprintln("Nothing to redo."))
+		return false
+	}
+
+	op := redoHistory[len(redoHistory)-1]
+	redoHistory = redoHistory[:len(redoHistory)-1]
+	restoreSnapshot(op.After)
+	restorePlayerFiles(op.FilesAfter)
+	undoHistory = append(undoHistory, op)
+	sendConsole(fmt.Sprintln("Redid:", op.Cmd))
+	return true
+}
+
+func listUndo() {
+	output := ""
+	for i := len(undoHistory) - 1; i >= 0; i-- {
+		output = output + fmt.Sprintf("%d: %s\n", len(undoHistory)-i, undoHistory[i].Cmd)
+	}
+	sendConsole(output)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// playerWorld runs a test in a directory of its own with the fighter played
+// by bob and saved to their player file.
+func playerWorld(t *testing.T) {
+	simWorld(t, 7)
+	os.Chdir(t.TempDir())
+	os.MkdirAll(filepath.Join("assets", "players"), 0755)
+
+	initTables(&world)
+	world.Players = []string{"bob"}
+	world.Chars[0].Playername = "bob"
+	savePlayerChar(world.Chars[0])
+}
+
+func TestUndoPlayerFiles(t *testing.T) {
+	playerWorld(t)
+
+	executeCommand(Command{Name: "xp", Args: []string{"fig", "300"}})
+	if loadPlayerChar("bob").XP != 300 {
+		t.Log("Expected the xp in bob's file but got ", loadPlayerChar("bob").XP)
+		t.FailNow()
+	}
+
+	undo()
+	if loadPlayerChar("bob").XP != 0 || world.Chars[0].XP != 0 {
+		t.Log("Expected undo to take the xp back out of bob's file but got ", loadPlayerChar("bob").XP)
+		t.Fail()
+	}
+
+	redo()
+	if loadPlayerChar("bob").XP != 300 || world.Chars[0].XP != 300 {
+		t.Log("Expected redo to put the xp back in bob's file but got ", loadPlayerChar("bob").XP)
+		t.Fail()
+	}
+}
+
+func TestUndoEquip(t *testing.T) {
+	playerWorld(t)
+	equipWorld()
+	world.Chars[0].Inventory = []string{"scale"}
+	savePlayerChar(world.Chars[0])
+
+	executeCommand(Command{Name: "equip", Args: []string{"fig", "scale"}})
+	if !hasItem(loadPlayerChar("bob").Equipped, "scale") {
+		t.Log("Expected the scale mail equipped in bob's file but got ", loadPlayerChar("bob").Equipped)
+		t.FailNow()
+	}
+
+	undo()
+	if len(loadPlayerChar("bob").Equipped) != 0 {
+		t.Log("Expected undo to take the scale mail off in bob's file but got ", loadPlayerChar("bob").Equipped)
+		t.Fail()
+	}
+
+	redo()
+	if !hasItem(loadPlayerChar("bob").Equipped, "scale") {
+		t.Log("Expected redo to put the scale mail back on in bob's file but got ", loadPlayerChar("bob").Equipped)
+		t.Fail()
+	}
+}
+
+func TestUndoTake(t *testing.T) {
+	playerWorld(t)
+	equipWorld()
+	world.Loot = map[string][]string{world.Place: {"rap"}}
+
+	executeCommand(Command{Name: "take", Args: []string{"rap", "fig"}})
+	if !hasItem(loadPlayerChar("bob").Inventory, "rap") {
+		t.Log("Expected the rapier in bob's file but got ", loadPlayerChar("bob").Inventory)
+		t.FailNow()
+	}
+
+	undo()
+	if hasItem(loadPlayerChar("bob").Inventory, "rap") || !hasItem(placeLoot(), "rap") {
+		t.Log("Expected undo to leave the rapier on the ground but got ", loadPlayerChar("bob").Inventory)
+		t.Fail()
+	}
+
+	redo()
+	if !hasItem(loadPlayerChar("bob").Inventory, "rap") {
+		t.Log("Expected redo to put the rapier back in bob's file but got ", loadPlayerChar("bob").Inventory)
+		t.Fail()
+	}
+}
+
+func TestUndoBuy(t *testing.T) {
+	playerWorld(t)
+	world.Objects = []Object{{Key: "lsw", Name: "longsword", Price: "15 gp"}}
+	world.Places = []Place{{Key: "market", Shop: []string{"lsw"}}}
+	world.Place = "market"
+	world.Chars[0].Purse = Purse{GP: 20}
+	savePlayerChar(world.Chars[0])
+
+	executeCommand(Command{Name: "buy", Args: []string{"fig", "lsw"}})
+	if bob := loadPlayerChar("bob"); !hasItem(bob.Inventory, "lsw") || bob.Purse.Value() != 500 {
+		t.Log("Expected the longsword bought in bob's file but got ", bob.Inventory, bob.Purse)
+		t.FailNow()
+	}
+
+	undo()
+	if bob := loadPlayerChar("bob"); hasItem(bob.Inventory, "lsw") || bob.Purse.GP != 20 {
+		t.Log("Expected undo to give bob the 20 gp back but got ", bob.Inventory, bob.Purse)
+		t.Fail()
+	}
+
+	redo()
+	if bob := loadPlayerChar("bob"); !hasItem(bob.Inventory, "lsw") || bob.Purse.Value() != 500 {
+		t.Log("Expected redo to buy the longsword again in bob's file but got ", bob.Inventory, bob.Purse)
+		t.Fail()
+	}
+}
+
+func TestUndoLoad(t *testing.T) {
+	playerWorld(t)
+	world.Players = []string{"bob", "alice"}
+	world.Charlist = "bob,alice"
+	saveWorld("both")
+	world.Players = []string{"bob"}
+	world.Charlist = "bob"
+
+	executeCommand(Command{Name: "load", Args: []string{"both"}})
+	if len(world.Players) != 2 {
+		t.Log("Expected the save's two players but got ", world.Players)
+		t.FailNow()
+	}
+
+	undo()
+	if len(world.Players) != 1 || world.Players[0] != "bob" || world.Charlist != "bob" {
+		t.Log("Expected undo to leave only bob playing but got ", world.Players, world.Charlist)
+		t.Fail()
+	}
+}
@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// nextLevelExp is the XP needed for the level after level, and false at the
+// top of Exptable.
+func nextLevelExp(level int) (int, bool) {
+	xp, ok := world.Exptable[level+1]
+	return xp, ok
+}
+
+func canLevelUp(char Char) bool {
+	if world.Milestone {
+		return char.MilestoneLevel > char.Level
+	}
+
+	xp, ok := nextLevelExp(char.Level)
+	return ok && char.XP >= xp
+}
+
+func levelUpMsg(char Char) string {
+	return fmt.Sprintf("<b>%s can advance to level %d!</b><br>", char.Name, char.Level+1)
+}
+
+// savePlayerChar writes a player character back to its players file.
+func savePlayerChar(char Char) {
+	if char.Playername == "" {
+		return
+	}
+
+	charbytes, err := json.Marshal(char)
+	if err != nil {
+		fmt.Println("Failed to save ", char.Name, ": ", err)
+		return
+	}
+	buf := bytes.NewBuffer(make([]byte, 0))
+	json.Indent(buf, charbytes, "", "  ")
+
+	err = writePlayerFile(char.Playername, buf.Bytes())
+	if err != nil {
+		fmt.Println("Failed to save ", char.Name, ": ", err)
+	}
+}
+
+// keepPlayerState copies what the edit form doesn't carry from the saved
+// char into the one built from the form.
+func keepPlayerState(char *Char, saved Char) {
+	char.XP = saved.XP
+	char.MilestoneLevel = saved.MilestoneLevel
+	char.Purse = saved.Purse
+	for i := range saved.Equipped {
+		if hasItem(char.Inventory, saved.Equipped[i]) {
+			char.Equipped = append(char.Equipped, saved.Equipped[i])
+		}
+	}
+}
+
+// awardExp gives xp to the char at index i of world.Chars, saving player
+// characters, and returns a message for the players if it can now level.
+func awardExp(i int, xp int) string {
+	could := canLevelUp(world.Chars[i])
+	world.Chars[i].XP = world.Chars[i].XP + xp
+	sendConsole(fmt.Sprintf("%s gains %d XP (%d total)\n", world.Chars[i].Name, xp, world.Chars[i].XP))
+	savePlayerChar(world.Chars[i])
+
+	if !could && canLevelUp(world.Chars[i]) {
+		return levelUpMsg(world.Chars[i])
+	}
+	return ""
+}
+
+// combatParticipants are the indexes in world.Chars of party members in the
+// initiative order.
+func combatParticipants() []int {
+	participants := make([]int, 0)
+	for i := range world.Chars {
+		if !world.Chars[i].InParty || charIsNpc(world.Chars[i].Key) {
+			continue
+		}
+
+		for k := range world.Outputar {
+			if strings.HasPrefix(world.Outputar[k], world.Chars[i].Name+" (") {
+				participants = append(participants, i)
+				break
+			}
+		}
+	}
+	return participants
+}
+
+// awardCombatExp shares the XP of everything defeated this combat between
+// the party members who fought, unless the campaign levels by milestone.
+func awardCombatExp() string {
+	pool := world.Combatexp
+	world.Combatexp = 0
+	if pool == 0 {
+		return ""
+	}
+
+	if world.Milestone {
+		sendConsole(fmt.Sprintln("Milestone levelling, not awarding", pool, "XP."))
+		return ""
+	}
+
+	participants := combatParticipants()
+	if len(participants) == 0 {
+		sendConsole(fmt.Sprintln("No one to award", pool, "XP to."))
+		return ""
+	}
+
+	share := pool / len(participants)
+	msg := fmt.Sprintf("The party earns %d XP, %d each.<br>", pool, share)
+	for i := range participants {
+		msg = msg + awardExp(participants[i], share)
+	}
+	return msg
+}
+
+// xpCommand handles "xp KEY AMOUNT".
+func xpCommand(cmd Command) string {
+	if len(cmd.Args) < 2 {
+		sendConsole(fmt.Sprintln("Usage: xp KEY AMOUNT"))
+		return ""
+	}
+
+	amount, err := strconv.Atoi(cmd.Args[1])
+	if err != nil {
+		sendConsole(fmt.Sprintln("Bad amount", cmd.Args[1]))
+		return ""
+	}
+
+	for i := range world.Chars {
+		if world.Chars[i].Key == cmd.Args[0] && !charIsNpc(world.Chars[i].Key) {
+			msg := awardExp(i, amount)
+			if msg == "" {
+				msg = " "
+			}
+			return msg
+		}
+	}
+
+	sendConsole(fmt.Sprintln("Failed to load ", cmd.Args[0]))
+	return ""
+}
+
+// milestoneCommand handles "milestone on|off" to switch levelling mode and
+// plain "milestone" to let the whole party advance a level.
+func milestoneCommand(cmd Command) string {
+	if len(cmd.Args) >= 1 {
+		world.Milestone = cmd.Args[0] == "on"
+		sendConsole(fmt.Sprintln("Milestone levelling:", world.Milestone))
+		return ""
+	}
+
+	if !world.Milestone {
+		sendConsole(fmt.Sprintln("Milestone levelling is off, use milestone on first."))
+		return ""
+	}
+
+	msg := ""
+	for i := range world.Chars {
+		if world.Chars[i].InParty && !charIsNpc(world.Chars[i].Key) {
+			world.Chars[i].MilestoneLevel = world.Chars[i].Level + 1
+			savePlayerChar(world.Chars[i])
+			msg = msg + levelUpMsg(world.Chars[i])
+		}
+	}
+	return msg
+}
+
+func printExp() {
+	output := fmt.Sprintf("Combat XP: %d\n", world.Combatexp)
+	for i := range world.Chars {
+		if world.Chars[i].InParty && !charIsNpc(world.Chars[i].Key) {
+			next, _ := nextLevelExp(world.Chars[i].Level)
+			output = output + fmt.Sprintf("  %s: level %d, %d/%d XP", world.Chars[i].Name, world.Chars[i].Level, world.Chars[i].XP, next)
+			if canLevelUp(world.Chars[i]) {
+				output = output + " (can level up)"
+			}
+			output = output + "\n"
+		}
+	}
+	sendConsole(output)
+}
+
+func renderLevelUp(char Char) string {
+	if !canLevelUp(char) {
+		return ""
+	}
+	return "<br><span class=\"levelup\">level up!</span>"
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestAwardCombatExp(t *testing.T) {
+	simWorld(t, 7)
+	initTables(&world)
+	world.Chars[0].Level = 1
+	world.Chars = append(world.Chars, Char{Name: "Rogue", Key: "rog", InParty: true, Level: 1, XP: 250})
+	world.Outputar = []string{"Fighter (15)", "Goblin (12)", "Rogue (8)"}
+
+	// a CR 1 creature is worth 200 xp, split between the two who fought
+	logExp(Char{Name: "Bugbear", CR: "1"})
+	msg := awardCombatExp()
+
+	if world.Chars[0].XP != 100 || world.Chars[2].XP != 350 || world.Combatexp != 0 {
+		t.Log("Expected 100 and 350 xp but got ", world.Chars[0].XP, world.Chars[2].XP)
+		t.Fail()
+	}
+
+	if !canLevelUp(world.Chars[2]) || canLevelUp(world.Chars[0]) {
+		t.Log("Expected only the rogue to be able to level up, got ", msg)
+		t.Fail()
+	}
+}
+
+func TestMilestoneAwardsNoExp(t *testing.T) {
+	simWorld(t, 7)
+	initTables(&world)
+	world.Outputar = []string{"Fighter (15)"}
+	world.Milestone = true
+
+	logExp(Char{Name: "Bugbear", CR: "1"})
+	awardCombatExp()
+	if world.Chars[0].XP != 0 {
+		t.Log("Expected no xp in milestone mode but got ", world.Chars[0].XP)
+		t.Fail()
+	}
+
+	milestoneCommand(Command{})
+	if !canLevelUp(world.Chars[0]) {
+		t.Log("Expected the fighter to be able to level up after a milestone")
+		t.Fail()
+	}
+}